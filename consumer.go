@@ -0,0 +1,146 @@
+package ringbuffer
+
+import (
+	"errors"
+)
+
+// -----------------------------------------------------------------------------
+
+// Consumer represents an independent reader of a circular buffer with its own read-position.
+// When a buffer has consumers, data is only released once all of them have read it.
+type Consumer struct {
+	rb     *RingBuffer
+	offset int // Holds the consumer read-position relative to the buffer read-position.
+}
+
+var errConsumerClosed = errors.New("consumer closed")
+
+// -----------------------------------------------------------------------------
+
+// NewConsumer returns a new consumer positioned at the start of the unread portion of the buffer.
+// Consumers must be closed when no longer needed, or the buffer data will never be released.
+// Reading directly from the buffer also advances the read-position of the consumers.
+func (r *RingBuffer) NewConsumer() *Consumer {
+	r.mtx.Lock()
+	defer r.unlock()
+
+	c := &Consumer{
+		rb: r,
+	}
+	r.consumers = append(r.consumers, c)
+
+	// Done
+	return c
+}
+
+// Read reads up to len(p) bytes from the buffer, starting at the consumer's read-position,
+// and stores them in p. Once all the consumers have read some data, it is released from the
+// buffer.
+// At the end of the buffer, Read returns 0, io.EOF, or 0, ErrClosed if the buffer was closed,
+// even if p is empty.
+func (c *Consumer) Read(p []byte) (n int, err error) {
+	r := c.rb
+	if r == nil {
+		return 0, errConsumerClosed
+	}
+
+	r.mtx.Lock()
+	defer r.unlock()
+
+	if c.offset >= r.written {
+		return 0, r.eof() // Nothing to read, even if p is empty.
+	}
+	n = len(p)
+	if n == 0 {
+		return 0, nil
+	}
+	if n > r.written-c.offset {
+		n = r.written - c.offset
+	}
+
+	// Read from the buffer.
+	ofs1, len1, len2 := r.rangeInfo(c.offset, n)
+	copy(p, r.buf[ofs1:ofs1+len1])
+	copy(p[len1:], r.buf[:len2])
+
+	// Advance the consumer read-position and release the data read by all the consumers.
+	c.offset += n
+	r.releaseConsumed()
+
+	// Done
+	return
+}
+
+// Len returns the number of bytes not read yet by the consumer.
+func (c *Consumer) Len() int {
+	r := c.rb
+	if r == nil {
+		return 0
+	}
+
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	return r.written - c.offset
+}
+
+// Close detaches the consumer from the buffer, so it no longer prevents data from being released.
+func (c *Consumer) Close() error {
+	r := c.rb
+	if r == nil {
+		return nil
+	}
+
+	r.mtx.Lock()
+	defer r.unlock()
+
+	for idx, other := range r.consumers {
+		if other == c {
+			r.consumers = append(r.consumers[:idx], r.consumers[idx+1:]...)
+			break
+		}
+	}
+	c.rb = nil
+	r.releaseConsumed()
+
+	// Done
+	return nil
+}
+
+// releaseConsumed advances the buffer read-position past the data read by all the consumers.
+func (r *RingBuffer) releaseConsumed() {
+	if len(r.consumers) == 0 {
+		return
+	}
+
+	minOffset := r.consumers[0].offset
+	for _, c := range r.consumers[1:] {
+		if c.offset < minOffset {
+			minOffset = c.offset
+		}
+	}
+	if minOffset > 0 {
+		r.advanceReadPos(minOffset)
+	}
+}
+
+// consumersAdvanced updates the consumers read-position after the buffer read-position
+// was advanced by n bytes.
+func (r *RingBuffer) consumersAdvanced(n int) {
+	for _, c := range r.consumers {
+		c.offset -= n
+		if c.offset < 0 {
+			c.offset = 0
+		}
+	}
+}
+
+// consumersTruncated updates the consumers read-position after the unread portion of the
+// buffer was truncated to n bytes.
+func (r *RingBuffer) consumersTruncated(n int) {
+	for _, c := range r.consumers {
+		if c.offset > n {
+			c.offset = n
+		}
+	}
+}
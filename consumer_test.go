@@ -0,0 +1,68 @@
+package ringbuffer_test
+
+import (
+	"io"
+	"testing"
+
+	"github.com/mxmauro/ringbuffer"
+)
+
+// -----------------------------------------------------------------------------
+
+func TestConsumer(t *testing.T) {
+	rb := ringbuffer.New(16)
+	fast := rb.NewConsumer()
+	slow := rb.NewConsumer()
+
+	_, _ = rb.Write([]byte("0123456789"))
+
+	// The fast consumer reads everything but the data must be kept for the slow one.
+	var buf [10]byte
+	n, err := fast.Read(buf[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf[:n]) != "0123456789" {
+		t.Fatal("invalid data read")
+	}
+	if _, err = fast.Read(buf[:]); err != io.EOF {
+		t.Fatal("expected EOF")
+	}
+	if rb.Len() != 10 {
+		t.Fatal("unexpected buffer length")
+	}
+
+	// The slow consumer reads part of the data.
+	n, _ = slow.Read(buf[:4])
+	if string(buf[:n]) != "0123" {
+		t.Fatal("invalid data read")
+	}
+	if rb.Len() != 6 || slow.Len() != 6 || fast.Len() != 0 {
+		t.Fatal("unexpected buffer length")
+	}
+
+	// New data must be available to both.
+	_, _ = rb.Write([]byte("ab"))
+	n, _ = fast.Read(buf[:])
+	if string(buf[:n]) != "ab" {
+		t.Fatal("invalid data read")
+	}
+	n, _ = slow.Read(buf[:])
+	if string(buf[:n]) != "456789ab" {
+		t.Fatal("invalid data read")
+	}
+	if rb.Len() != 0 {
+		t.Fatal("unexpected buffer length")
+	}
+
+	// Closing a consumer releases the data it retains.
+	_, _ = rb.Write([]byte("cd"))
+	_, _ = fast.Read(buf[:])
+	_ = slow.Close()
+	if rb.Len() != 0 {
+		t.Fatal("unexpected buffer length")
+	}
+	if _, err = slow.Read(buf[:]); err == nil {
+		t.Fatal("expected error")
+	}
+}
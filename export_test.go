@@ -0,0 +1,35 @@
+package ringbuffer
+
+// -----------------------------------------------------------------------------
+
+var ErrInvalidCapacity = errInvalidCapacity
+var ErrInvalidReadPos = errInvalidReadPos
+var ErrInvalidWritten = errInvalidWritten
+var ErrInvalidConsumer = errInvalidConsumer
+
+// -----------------------------------------------------------------------------
+
+// SetState overwrites the read-position and the unread length of the buffer without any check.
+func (r *RingBuffer) SetState(readPos int, written int) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.readPos = readPos
+	r.written = written
+}
+
+// SetGrowSize overwrites the grow size of the buffer without any check.
+func (r *RingBuffer) SetGrowSize(growSize int) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.growSize = growSize
+}
+
+// BackingArray returns the internal storage of the buffer.
+func (r *RingBuffer) BackingArray() []byte {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	return r.buf
+}
@@ -0,0 +1,148 @@
+package ringbuffer
+
+import (
+	"io"
+	"sync"
+)
+
+// -----------------------------------------------------------------------------
+
+// Ring represents a thread-safe circular buffer of elements of an arbitrary type.
+type Ring[T any] struct {
+	mtx      sync.Mutex
+	buf      []T
+	growSize int
+	readPos  int // Holds the read-position in the buffer.
+	written  int // Holds the number of elements written to the buffer.
+}
+
+// -----------------------------------------------------------------------------
+
+// NewRing returns a new circular buffer of elements with an initial size.
+// The size is rounded up to the next power of two and limited to 1M elements. If the buffer
+// needs to be expanded, it will grow in steps of that size.
+func NewRing[T any](growSize int) *Ring[T] {
+	// Create and initialize the ring.
+	r := &Ring[T]{}
+	r.Initialize(growSize)
+
+	// Done
+	return r
+}
+
+// Initialize initializes a circular buffer of elements with an initial size.
+// The size is rounded up to the next power of two and limited to 1M elements. If the buffer
+// needs to be expanded, it will grow in steps of that size.
+func (r *Ring[T]) Initialize(growSize int) {
+	if growSize < minGrowSize {
+		growSize = minGrowSize
+	} else if growSize > maxGrowSize {
+		growSize = maxGrowSize
+	} else {
+		growSize = nextPowerOfTwo(growSize)
+	}
+
+	// Initialize the ring.
+	r.buf = make([]T, growSize)
+	r.growSize = growSize
+}
+
+// Push adds an element to the end of the buffer.
+func (r *Ring[T]) Push(elem T) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	// Ensure there is enough space to hold the new element.
+	if r.written == len(r.buf) {
+		r.growBuffer(len(r.buf) + r.growSize)
+	}
+
+	// Store the element at the current write-position.
+	pos := r.readPos + r.written
+	if pos >= len(r.buf) {
+		pos -= len(r.buf)
+	}
+	r.buf[pos] = elem
+
+	// Advance the write-position.
+	r.written += 1
+}
+
+// Pop removes and returns the first element of the buffer.
+// If the buffer is empty, Pop returns the zero value and io.EOF.
+func (r *Ring[T]) Pop() (elem T, err error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if r.written == 0 {
+		return elem, io.EOF // Nothing to read.
+	}
+
+	// Get the element and release the slot so it can be garbage collected.
+	var zero T
+	elem = r.buf[r.readPos]
+	r.buf[r.readPos] = zero
+
+	// Advance the read-position.
+	r.readPos += 1
+	if r.readPos == len(r.buf) {
+		r.readPos = 0
+	}
+	r.written -= 1
+
+	// Done
+	return
+}
+
+// Peek returns the first element of the buffer without removing it.
+// If the buffer is empty, Peek returns the zero value and io.EOF.
+func (r *Ring[T]) Peek() (elem T, err error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if r.written == 0 {
+		return elem, io.EOF // Nothing to read.
+	}
+	return r.buf[r.readPos], nil
+}
+
+// Scan calls fn for each element in the buffer.
+// If the callback returns true, Scan stops the iteration.
+func (r *Ring[T]) Scan(fn func(elem T, idx int) bool) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	for idx := 0; idx < r.written; idx++ {
+		pos := r.readPos + idx
+		if pos >= len(r.buf) {
+			pos -= len(r.buf)
+		}
+		stop := fn(r.buf[pos], idx)
+		if stop {
+			return
+		}
+	}
+}
+
+// Len returns the number of elements in the buffer.
+func (r *Ring[T]) Len() int {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	return r.written
+}
+
+func (r *Ring[T]) growBuffer(newSize int) {
+	newBuf := make([]T, newSize)
+
+	if r.readPos+r.written <= len(r.buf) {
+		copy(newBuf, r.buf[r.readPos:r.readPos+r.written])
+	} else {
+		temp := len(r.buf) - r.readPos
+		copy(newBuf, r.buf[r.readPos:])
+		copy(newBuf[temp:], r.buf[:r.written-temp])
+	}
+
+	r.buf = newBuf
+	r.readPos = 0
+}
@@ -0,0 +1,73 @@
+package ringbuffer_test
+
+import (
+	"io"
+	"testing"
+
+	"github.com/mxmauro/ringbuffer"
+)
+
+// -----------------------------------------------------------------------------
+
+type testElem struct {
+	id   int
+	name string
+}
+
+// -----------------------------------------------------------------------------
+
+func TestRing(t *testing.T) {
+	r := ringbuffer.NewRing[testElem](16)
+
+	// Move the read-position near the end of the backing array.
+	for i := 0; i < 12; i++ {
+		r.Push(testElem{})
+		_, _ = r.Pop()
+	}
+
+	// Push elements across the wrap boundary and force a grow.
+	for i := 0; i < 20; i++ {
+		r.Push(testElem{
+			id:   i,
+			name: "elem",
+		})
+	}
+	if r.Len() != 20 {
+		t.Fatal("unexpected ring length")
+	}
+
+	elem, err := r.Peek()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elem.id != 0 {
+		t.Fatal("invalid element peeked")
+	}
+
+	count := 0
+	r.Scan(func(elem testElem, idx int) bool {
+		if elem.id != idx {
+			t.Fatal("invalid element scanned")
+		}
+		count += 1
+		return false
+	})
+	if count != 20 {
+		t.Fatal("unexpected scanned elements count")
+	}
+
+	for i := 0; i < 20; i++ {
+		elem, err = r.Pop()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if elem.id != i || elem.name != "elem" {
+			t.Fatal("invalid element popped")
+		}
+	}
+
+	_, err = r.Pop()
+	if err != io.EOF {
+		t.Fatal("expected EOF")
+	}
+}
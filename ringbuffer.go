@@ -1,27 +1,117 @@
 package ringbuffer
 
 import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
 	"errors"
+	"hash/crc32"
 	"io"
+	"math"
+	"math/bits"
+	"os"
 	"sync"
+	"time"
+	"unicode/utf8"
+	"unsafe"
 )
 
 // -----------------------------------------------------------------------------
 
+const (
+	minGrowSize = 16
+	maxGrowSize = 1048576
+	minReadSize = 512
+
+	defaultMaxSize = math.MaxInt
+
+	recordHeaderSize = 12
+)
+
+// ErrBufferOverflow is returned when the buffer cannot hold the data being written.
+var ErrBufferOverflow = errors.New("buffer overflow")
+
+// ErrClosed is returned when operating on a closed buffer.
+var ErrClosed = errors.New("buffer closed")
+
+// ErrDelimiterNotFound is returned when the requested delimiter is not present in the buffer.
+var ErrDelimiterNotFound = errors.New("delimiter not found")
+
+// ErrConflict is returned when the buffer was modified after a token was issued by PeekToken.
+var ErrConflict = errors.New("buffer modified")
+
+// ErrShortRead is returned when the buffer does not contain enough data to satisfy a read.
+var ErrShortRead = errors.New("short read")
+
+var errInvalidEncoding = errors.New("invalid encoded data")
+var errEmptyDelimiter = errors.New("empty delimiter")
+var errNegativeCount = errors.New("negative count")
+var errCommitOutOfRange = errors.New("commit out of range")
+var errNegativeOffset = errors.New("negative offset")
+var errOverwriteOutOfRange = errors.New("overwrite out of range")
+var errNegativeRead = errors.New("reader returned negative count from Read")
+var errRewindOutOfRange = errors.New("rewind out of range")
+var errSectionOutOfRange = errors.New("section out of range")
+var errRecordTooLarge = errors.New("record too large")
+var errInvalidGrowSize = errors.New("invalid state: grow size out of range")
+var errInvalidCapacity = errors.New("invalid state: capacity out of range")
+var errInvalidReadPos = errors.New("invalid state: read-position out of range")
+var errInvalidWritten = errors.New("invalid state: unread length out of range")
+var errInvalidConsumer = errors.New("invalid state: consumer read-position out of range")
+
+// -----------------------------------------------------------------------------
+
 // RingBuffer represents a thread-safe circular buffer.
 type RingBuffer struct {
-	mtx      sync.Mutex
-	buf      []byte
-	growSize int
-	readPos  int // Holds the read-position in the buffer.
-	written  int // Holds the number of bytes written to the buffer.
+	mtx        sync.RWMutex
+	cond       sync.Cond // Signaled when data is written to or read from the buffer.
+	buf        []byte
+	growSize   int
+	linearBase int  // If greater than zero, holds the initial capacity of a linear buffer.
+	maxSize    int  // If greater than zero, overrides the default maximum size of the buffer.
+	bounded    bool // If true, the buffer never grows.
+	closed     bool
+	eofOnDrain bool // If true, Read returns io.EOF along with the last bytes.
+	zeroOnRead bool // If true, consumed data is overwritten with zeroes.
+	readPos    int  // Holds the read-position in the buffer.
+	written    int  // Holds the number of bytes written to the buffer.
+	rewindable int  // Holds the number of already read bytes before the read-position still intact.
+	consumers  []*Consumer
+	version    uint64 // Incremented each time the buffer is modified.
+	recordSeq  uint64 // Holds the sequence number of the last record written.
+
+	growFn func(current int, needed int) int // If not nil, computes the new size of the buffer.
+
+	autoShrinkReads int // If greater than zero, the buffer is shrunk after that many idle reads.
+	idleReads       int // Holds the number of consecutive reads with low buffer usage.
+
+	onRead       func(n int)
+	onWrite      func(n int)
+	readPending  int       // Holds the number of bytes read not yet reported to onRead.
+	writePending int       // Holds the number of bytes written not yet reported to onWrite.
+	tee          io.Writer // If not nil, receives a copy of the data consumed by Read.
+
+	flushWatermark int  // If greater than zero, onFlush is called when the unread length reaches it.
+	flushPending   bool // If true, onFlush must be called when the lock is released.
+	onFlush        func()
+
+	readDeadline      time.Time
+	readDeadlineTimer *time.Timer
+
+	totalWritten uint64 // Holds the number of bytes written during the buffer lifetime.
+	totalRead    uint64 // Holds the number of bytes read during the buffer lifetime.
+	grows        int    // Holds the number of times the buffer was expanded.
+	allocBytes   uint64 // Holds the number of bytes allocated when the buffer was expanded.
 }
 
 // -----------------------------------------------------------------------------
 
 // New returns a new circular buffer with an initial size.
-// If the buffer needs to be expanded, it will be expanded to the next
-// power of two greater than the requested size.
+// The size is rounded up to the next power of two and limited to the range
+// from 16 bytes to 1 MiB, so zero or negative sizes behave like 16. If the buffer
+// needs to be expanded, it will grow in steps of that size without any limit unless one is
+// set with SetMaxSize.
 func New(growSize int) *RingBuffer {
 	// Create and initialize the ring buffer.
 	r := &RingBuffer{}
@@ -31,139 +121,2247 @@ func New(growSize int) *RingBuffer {
 	return r
 }
 
+// NewBounded returns a new fixed-capacity circular buffer.
+// The capacity is rounded up to the next power of two like in New, but the buffer
+// never grows. Writes that do not fit in the free space are truncated.
+func NewBounded(size int) *RingBuffer {
+	// Create and initialize the ring buffer.
+	r := &RingBuffer{}
+	r.Initialize(size)
+	r.bounded = true
+
+	// Done
+	return r
+}
+
+// NewWithGrowStep returns a new circular buffer with an initial capacity of exactly initial
+// bytes that grows in linear increments of exactly step bytes, that is, its capacity will be
+// initial, initial+step, initial+2*step and so on. No power of two rounding is applied.
+func NewWithGrowStep(initial int, step int) *RingBuffer {
+	if step < minGrowSize {
+		step = minGrowSize
+	} else if step > maxGrowSize {
+		step = maxGrowSize
+	}
+	if initial <= 0 {
+		initial = step
+	}
+
+	// Create and initialize the ring buffer.
+	r := &RingBuffer{}
+	r.cond.L = &r.mtx
+	r.buf = make([]byte, initial)
+	r.growSize = step
+	r.linearBase = initial
+
+	// Done
+	return r
+}
+
+// NewExact returns a new circular buffer with an initial capacity of exactly size bytes that
+// grows in increments of size bytes. No power of two rounding is applied. If size is zero or
+// negative, the initial capacity is 16 bytes. Like in NewWithGrowStep, the increment is still
+// limited to the range from 16 bytes to 1 MiB.
+func NewExact(size int) *RingBuffer {
+	return NewWithGrowStep(size, size)
+}
+
+// NewWithCapacity returns a new circular buffer with an initial capacity of exactly initial
+// bytes. The grow size is rounded and limited like in New and, if the buffer needs to be
+// expanded, it will grow in steps of that size. If initial is zero or negative, the initial
+// capacity is the grow size.
+func NewWithCapacity(initial int, growSize int) *RingBuffer {
+	// Create and initialize the ring buffer.
+	r := &RingBuffer{}
+	r.Initialize(growSize)
+	if initial > 0 && initial != len(r.buf) {
+		r.buf = make([]byte, initial)
+	}
+
+	// Done
+	return r
+}
+
+// NewFromBytes returns a new circular buffer whose unread portion is a copy of data.
+// The initial capacity is the next power of two that can hold data, but never less than the
+// grow size, which is rounded and limited like in New.
+func NewFromBytes(data []byte, growSize int) *RingBuffer {
+	// Create and initialize the ring buffer.
+	r := &RingBuffer{}
+	r.Initialize(growSize)
+	if len(data) > len(r.buf) {
+		r.buf = make([]byte, nextPowerOfTwo(len(data)))
+	}
+
+	// Store the data.
+	copy(r.buf, data)
+	r.written = len(data)
+
+	// Done
+	return r
+}
+
 // Initialize initializes a circular buffer with an initial size.
-// If the buffer needs to be expanded, it will be expanded to the next
-// power of two greater than the requested size.
+// The size is rounded up to the next power of two and limited to the range
+// from 16 bytes to 1 MiB, so zero or negative sizes behave like 16. If the buffer
+// needs to be expanded, it will grow in steps of that size without any limit unless one is
+// set with SetMaxSize.
 func (r *RingBuffer) Initialize(growSize int) {
-	if growSize <= 15 {
-		growSize = 16
-	} else if growSize > 1048576 {
-		growSize = 1048576
+	if growSize < minGrowSize {
+		growSize = minGrowSize
+	} else if growSize > maxGrowSize {
+		growSize = maxGrowSize
 	} else {
-		growSize -= 1
-		growSize |= growSize >> 1
-		growSize |= growSize >> 2
-		growSize |= growSize >> 4
-		growSize |= growSize >> 8
-		growSize |= growSize >> 16
-		growSize += 1
+		growSize = nextPowerOfTwo(growSize)
 	}
 
 	// Initialize the ring buffer.
+	r.cond.L = &r.mtx
 	r.buf = make([]byte, growSize)
 	r.growSize = growSize
 }
 
+// SetGrowStrategy sets a function that computes the new size of the buffer, given the current
+// capacity and the capacity needed to hold the data being written, when it must be expanded.
+// Values smaller than the needed capacity are raised to it, and values above the maximum size
+// are limited to it. A nil function restores the default strategy of growing in steps of the
+// grow size.
+func (r *RingBuffer) SetGrowStrategy(fn func(current int, needed int) int) {
+	r.mtx.Lock()
+	defer r.unlock()
+
+	r.growFn = fn
+}
+
+// SetMaxSize sets the maximum size the buffer can grow to. Writes that would require a larger
+// buffer fail with ErrBufferOverflow. A value of zero or less removes the limit.
+// SetMaxSize does not shrink an already allocated buffer.
+func (r *RingBuffer) SetMaxSize(max int) {
+	r.mtx.Lock()
+	defer r.unlock()
+
+	if max < 0 {
+		max = 0
+	}
+	r.maxSize = max
+}
+
+// Clone returns a new independent circular buffer with the same settings and a copy of
+// the contents of this one. Hooks, the tee writer and the flush callback are shared with
+// the clone, but consumers and the read deadline are not copied.
+func (r *RingBuffer) Clone() *RingBuffer {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	c := &RingBuffer{
+		buf:        make([]byte, len(r.buf)),
+		growSize:   r.growSize,
+		growFn:     r.growFn,
+		linearBase: r.linearBase,
+		maxSize:    r.maxSize,
+		bounded:    r.bounded,
+		closed:     r.closed,
+		eofOnDrain: r.eofOnDrain,
+		zeroOnRead: r.zeroOnRead,
+		readPos:    r.readPos,
+		written:    r.written,
+		recordSeq:  r.recordSeq,
+
+		autoShrinkReads: r.autoShrinkReads,
+
+		onRead:  r.onRead,
+		onWrite: r.onWrite,
+		tee:     r.tee,
+
+		flushWatermark: r.flushWatermark,
+		onFlush:        r.onFlush,
+
+		totalWritten: r.totalWritten,
+		totalRead:    r.totalRead,
+		grows:        r.grows,
+		allocBytes:   r.allocBytes,
+	}
+	c.cond.L = &c.mtx
+	copy(c.buf, r.buf)
+
+	// Done
+	return c
+}
+
+// SetEOFOnDrain sets whether Read must return io.EOF in the same call that reads the last
+// bytes of the buffer instead of in the next one. It is disabled by default.
+func (r *RingBuffer) SetEOFOnDrain(enable bool) {
+	r.mtx.Lock()
+	defer r.unlock()
+
+	r.eofOnDrain = enable
+}
+
+// SetZeroOnRead sets whether data must be overwritten with zeroes in the internal storage as
+// soon as it is consumed by any read or discard operation, so sensitive data does not linger in
+// memory. The whole storage is also wiped on Reset and, before being released, when the buffer
+// is expanded or shrunk. While enabled, consumed data cannot be recovered with Rewind or
+// History. It is disabled by default.
+func (r *RingBuffer) SetZeroOnRead(enable bool) {
+	r.mtx.Lock()
+	defer r.unlock()
+
+	r.zeroOnRead = enable
+}
+
+// SetTee sets a writer that receives a copy of the data consumed by each Read call, in the
+// same order it is read, like io.TeeReader does. The writer is called while the buffer is
+// locked, so it must not use the buffer. Errors returned by the writer are reported by Read.
+// A nil writer disables the tee.
+func (r *RingBuffer) SetTee(w io.Writer) {
+	r.mtx.Lock()
+	defer r.unlock()
+
+	r.tee = w
+}
+
+// SetHooks sets the callbacks invoked with the number of bytes transferred after each call that
+// transfers data. onRead is notified of the data consumed by any method, including Discard,
+// Skip, and the data released once all the consumers have read it, and onWrite of the data
+// added by any method. Nil callbacks are ignored.
+// Hooks are called after the buffer lock is released, but they run synchronously in the
+// goroutine calling the method, so they must not block waiting for another goroutine that is
+// using the buffer. Methods that block report the data transferred so far before waiting.
+func (r *RingBuffer) SetHooks(onRead func(n int), onWrite func(n int)) {
+	r.mtx.Lock()
+	defer r.unlock()
+
+	r.onRead = onRead
+	r.onWrite = onWrite
+}
+
+// SetFlushWatermark sets a callback invoked, after the buffer lock is released, each time a
+// call that adds data makes the unread length reach or cross the given number of bytes. The
+// callback is called again only after the unread length drops below the watermark and reaches
+// it again.
+// A watermark of zero or less, or a nil callback, disables the notification.
+func (r *RingBuffer) SetFlushWatermark(bytes int, onFlush func()) {
+	r.mtx.Lock()
+	defer r.unlock()
+
+	if onFlush == nil || bytes < 0 {
+		bytes = 0
+	}
+	r.flushWatermark = bytes
+	r.onFlush = onFlush
+}
+
+// SetAutoShrink sets whether the buffer must be automatically shrunk, like in Shrink, once
+// idleReads consecutive reads left the unread data below a quarter of the buffer capacity. The
+// buffer is shrunk by the next read that also does, that is, by the read number idleReads+1.
+// Only reads that consume data are counted, and the count restarts whenever a read leaves more
+// data than that. It is disabled by default.
+func (r *RingBuffer) SetAutoShrink(enable bool, idleReads int) {
+	r.mtx.Lock()
+	defer r.unlock()
+
+	if !enable {
+		idleReads = 0
+	} else if idleReads < 1 {
+		idleReads = 1
+	}
+	r.autoShrinkReads = idleReads
+	r.idleReads = 0
+}
+
+// MarshalBinary encodes the grow size and the unread portion of the buffer into a binary form.
+// It implements the encoding.BinaryMarshaler interface.
+func (r *RingBuffer) MarshalBinary() ([]byte, error) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	data := make([]byte, 16+r.written)
+	binary.BigEndian.PutUint64(data[0:8], uint64(r.growSize))
+	binary.BigEndian.PutUint64(data[8:16], uint64(r.written))
+	_, _ = r.peek(data[16:])
+
+	// Done
+	return data, nil
+}
+
+// UnmarshalBinary decodes the data produced by MarshalBinary replacing the grow size and the
+// contents of the buffer. Other settings are preserved, so bounded buffers keep their capacity,
+// and ErrBufferOverflow is returned if the decoded data does not fit in it or exceeds the
+// maximum size.
+// It implements the encoding.BinaryUnmarshaler interface.
+func (r *RingBuffer) UnmarshalBinary(data []byte) error {
+	if len(data) < 16 {
+		return errInvalidEncoding
+	}
+	growSize := binary.BigEndian.Uint64(data[0:8])
+	written := binary.BigEndian.Uint64(data[8:16])
+	if growSize < minGrowSize || growSize > maxGrowSize || written != uint64(len(data)-16) {
+		return errInvalidEncoding
+	}
+
+	r.mtx.Lock()
+	defer r.unlock()
+
+	limit := r.maxSize
+	if limit <= 0 {
+		limit = defaultMaxSize
+	}
+	if r.bounded {
+		limit = len(r.buf)
+	}
+	if written > uint64(limit) {
+		return ErrBufferOverflow
+	}
+
+	// Allocate storage for the data in multiples of the grow size. Bounded buffers keep
+	// their capacity.
+	r.growSize = int(growSize)
+	size := r.growSize
+	if r.bounded {
+		size = len(r.buf)
+	} else if int(written) > size {
+		size = int(written)
+		if rem := size % r.growSize; rem != 0 {
+			size += r.growSize - rem
+			if size > limit {
+				size = limit
+			}
+		}
+	}
+
+	if r.zeroOnRead {
+		// Wipe the old storage before releasing it.
+		clear(r.buf)
+	}
+	r.cond.L = &r.mtx
+	r.buf = make([]byte, size)
+	copy(r.buf, data[16:])
+	r.readPos = 0
+	r.written = int(written)
+	r.rewindable = 0
+	r.version += 1
+	r.consumersTruncated(0)
+
+	// Done
+	return nil
+}
+
+// GobEncode encodes the buffer using the same format as MarshalBinary.
+// It implements the gob.GobEncoder interface.
+func (r *RingBuffer) GobEncode() ([]byte, error) {
+	return r.MarshalBinary()
+}
+
+// GobDecode decodes the data produced by GobEncode.
+// It implements the gob.GobDecoder interface.
+func (r *RingBuffer) GobDecode(data []byte) error {
+	return r.UnmarshalBinary(data)
+}
+
+// SetReadDeadline sets the deadline for blocking reads like ReadFull and ReadContext. Once the
+// deadline is exceeded, they return os.ErrDeadlineExceeded. A zero value for t clears the deadline.
+func (r *RingBuffer) SetReadDeadline(t time.Time) {
+	r.mtx.Lock()
+	defer r.unlock()
+
+	if r.readDeadlineTimer != nil {
+		r.readDeadlineTimer.Stop()
+		r.readDeadlineTimer = nil
+	}
+	r.readDeadline = t
+
+	// Wake up the waiting readers when the deadline is reached.
+	if !t.IsZero() {
+		r.readDeadlineTimer = time.AfterFunc(time.Until(t), func() {
+			r.mtx.Lock()
+			r.cond.Broadcast()
+			r.mtx.Unlock()
+		})
+	}
+}
+
 // Peek reads up to len(p) bytes from the buffer without advancing the read-position.
 // It returns the number of bytes read and any error encountered.
-// At the end of the buffer, Peek returns 0, io.EOF.
+// At the end of the buffer, Peek returns 0, io.EOF, or 0, ErrClosed if the buffer was closed,
+// even if p is empty.
 func (r *RingBuffer) Peek(p []byte) (n int, err error) {
-	r.mtx.Lock()
-	defer r.mtx.Unlock()
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
 
 	// Read from the buffer.
 	return r.peek(p)
 }
 
-// Read reads up to len(p) bytes from the buffer and stores them in p.
-// It returns the number of bytes read and any error encountered.
-// At the end of the buffer, Read returns 0, io.EOF.
-func (r *RingBuffer) Read(p []byte) (n int, err error) {
-	r.mtx.Lock()
-	defer r.mtx.Unlock()
+// PeekAt reads up to len(p) bytes from the buffer, starting at the given offset of the unread
+// portion, without advancing the read-position. It returns the number of bytes read and any
+// error encountered. If offset is beyond the end of the unread data, PeekAt returns 0, io.EOF.
+func (r *RingBuffer) PeekAt(offset int, p []byte) (n int, err error) {
+	if offset < 0 {
+		return 0, errNegativeOffset
+	}
+
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	if offset >= r.written {
+		return 0, r.eof() // Nothing to read.
+	}
+
+	n = len(p)
+	if n > r.written-offset {
+		n = r.written - offset
+	}
 
 	// Read from the buffer.
-	n, err = r.peek(p)
-	if err == nil {
-		// Advance the read-position.
-		r.advanceReadPos(n)
+	ofs1, len1, len2 := r.rangeInfo(offset, n)
+	copy(p, r.buf[ofs1:ofs1+len1])
+	copy(p[len1:], r.buf[:len2])
+
+	// Done
+	return
+}
+
+// CopyTo copies up to len(p) bytes from the unread portion of the buffer into p without
+// advancing the read-position. It returns the number of bytes copied.
+func (r *RingBuffer) CopyTo(p []byte) int {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	n, _ := r.peek(p)
+	return n
+}
+
+// PeekSegments returns the unread portion of the buffer as two slices that reference the
+// internal storage directly, without copying. The second slice is nil if the unread data
+// is contiguous.
+//
+// WARNING: The returned slices are only valid until the next call that modifies the buffer
+// and must not be used while other goroutines access the buffer.
+func (r *RingBuffer) PeekSegments() (first []byte, second []byte) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	ofs1, len1, len2 := r.readInfo()
+	if len1 > 0 {
+		first = r.buf[ofs1 : ofs1+len1]
+	}
+	if len2 > 0 {
+		second = r.buf[:len2]
 	}
 	return
 }
 
-// Write writes len(p) bytes from p to the buffer.
-// It returns the number of bytes written and an error, if any.
-// Write returns a non-nil error when n != len(p).
-func (r *RingBuffer) Write(p []byte) (n int, err error) {
-	n = len(p)
-	if n == 0 {
-		return 0, nil
+// Chunks calls fn for successive windows of size bytes of the unread portion of the buffer,
+// without advancing the read-position. The last window may be shorter. If the callback returns
+// false, Chunks stops the iteration. If size is zero or negative, fn is never called.
+// Windows that are contiguous in the internal storage reference it directly, and the single
+// window that straddles the end of the backing array, if any, is a copy.
+//
+// WARNING: The buffer is locked while fn runs, so fn must not modify it, and the windows must
+// not be used after fn returns.
+func (r *RingBuffer) Chunks(size int, fn func(chunk []byte) bool) {
+	if size <= 0 {
+		return
 	}
 
-	r.mtx.Lock()
-	defer r.mtx.Unlock()
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
 
-	// Ensure there is enough space to hold the new data.
-	err = r.ensureCapacity(n)
-	if err != nil {
-		n = 0
-		return
+	for offset := 0; offset < r.written; offset += size {
+		var chunk []byte
+
+		n := size
+		if n > r.written-offset {
+			n = r.written - offset
+		}
+		ofs1, len1, len2 := r.rangeInfo(offset, n)
+		if len2 == 0 {
+			chunk = r.buf[ofs1 : ofs1+len1]
+		} else {
+			chunk = make([]byte, n)
+			copy(chunk, r.buf[ofs1:ofs1+len1])
+			copy(chunk[len1:], r.buf[:len2])
+		}
+		if !fn(chunk) {
+			return
+		}
 	}
+}
 
-	// Get the writable portion of the buffer.
-	ofs1, len1, len2 := r.writeInfo()
-	if n <= len1 {
-		copy(r.buf[ofs1:ofs1+n], p)
+// PeekToken returns up to n bytes of the unread portion of the buffer without advancing the
+// read-position, along with a token to be passed to CommitToken. The returned slice references
+// the internal storage directly if the data is contiguous, or is a copy otherwise.
+// If the buffer is empty, PeekToken returns io.EOF, or ErrClosed if the buffer was closed.
+//
+// WARNING: The returned slice is only valid until the next call that modifies the buffer.
+func (r *RingBuffer) PeekToken(n int) (data []byte, token uint64, err error) {
+	if n < 0 {
+		return nil, 0, errNegativeCount
+	}
+
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	if r.written == 0 {
+		return nil, 0, r.eof() // Nothing to read.
+	}
+	if n > r.written {
+		n = r.written
+	}
+
+	ofs1, len1, len2 := r.rangeInfo(0, n)
+	if len2 == 0 {
+		data = r.buf[ofs1 : ofs1+len1]
 	} else {
-		copy(r.buf[ofs1:], p[:len1])
-		copy(r.buf[:len2], p[len1:])
+		data = make([]byte, n)
+		copy(data, r.buf[ofs1:ofs1+len1])
+		copy(data[len1:], r.buf[:len2])
 	}
 
-	// Advance the write-position.
-	r.advanceWritePos(n)
+	// Done
+	return data, r.version, nil
+}
+
+// CommitToken advances the read-position by consumed bytes, but only if the buffer was not
+// modified since PeekToken returned the given token. Otherwise, it returns ErrConflict and
+// the read-position is not changed.
+func (r *RingBuffer) CommitToken(token uint64, consumed int) error {
+	r.mtx.Lock()
+	defer r.unlock()
+
+	if token != r.version {
+		return ErrConflict
+	}
+	if consumed < 0 || consumed > r.written {
+		return errCommitOutOfRange
+	}
+
+	// Advance the read-position.
+	r.advanceReadPos(consumed)
+
+	// Done
+	return nil
+}
+
+// CommitRead advances the read-position by n bytes. It is intended to be used after processing
+// the slices returned by PeekSegments.
+// It panics if n is negative or greater than the length of the unread portion of the buffer.
+func (r *RingBuffer) CommitRead(n int) {
+	r.mtx.Lock()
+	defer r.unlock()
+
+	if n < 0 || n > r.written {
+		panic("ringbuffer: read commit out of range")
+	}
+
+	// Advance the read-position.
+	r.advanceReadPos(n)
+}
+
+// Bytes returns a copy of the unread portion of the buffer without advancing the read-position.
+// The returned slice is newly allocated on each call, so the caller is free to modify it.
+func (r *RingBuffer) Bytes() []byte {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	buf := make([]byte, r.written)
+	_, _ = r.peek(buf)
+	return buf
+}
+
+// Partition returns a copy of the unread portion of the buffer split into n consecutive slices
+// whose lengths differ at most by one, without advancing the read-position. If n is greater than
+// the length of the unread data, the last slices are empty. If n is zero or negative, Partition
+// returns nil.
+func (r *RingBuffer) Partition(n int) [][]byte {
+	if n <= 0 {
+		return nil
+	}
+
+	data := r.Bytes()
+
+	// Split the copy, giving the remainder to the first partitions.
+	parts := make([][]byte, n)
+	size := len(data) / n
+	extra := len(data) % n
+	start := 0
+	for idx := range parts {
+		end := start + size
+		if idx < extra {
+			end += 1
+		}
+		parts[idx] = data[start:end:end]
+		start = end
+	}
+
+	// Done
+	return parts
+}
+
+// Checksum returns the CRC-32 checksum, using the IEEE polynomial, of the unread portion of the
+// buffer without advancing the read-position.
+func (r *RingBuffer) Checksum() uint32 {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	ofs1, len1, len2 := r.readInfo()
+	crc := crc32.Update(0, crc32.IEEETable, r.buf[ofs1:ofs1+len1])
+	return crc32.Update(crc, crc32.IEEETable, r.buf[:len2])
+}
+
+// HexDump returns a string containing a hex dump of the unread portion of the buffer, in the
+// same format used by hex.Dump, without advancing the read-position.
+func (r *RingBuffer) HexDump() string {
+	return hex.Dump(r.Bytes())
+}
+
+// NewReader returns a reader over a snapshot of the unread portion of the buffer. The reader
+// supports seeking and is independent of the buffer, so reading from it does not advance the
+// read-position and later modifications of the buffer are not visible to it.
+func (r *RingBuffer) NewReader() io.ReadSeeker {
+	return bytes.NewReader(r.Bytes())
+}
+
+// Section returns a reader over a snapshot of length bytes of the unread portion of the buffer,
+// starting at the given offset. Like in NewReader, reading from it does not advance the
+// read-position. If the range is not within the unread data, all reads from the returned reader
+// fail.
+func (r *RingBuffer) Section(offset int, length int) io.Reader {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	if offset < 0 || length < 0 || offset > r.written || length > r.written-offset {
+		return &errorReader{
+			err: errSectionOutOfRange,
+		}
+	}
+
+	// Copy the requested range.
+	buf := make([]byte, length)
+	ofs1, len1, len2 := r.rangeInfo(offset, length)
+	copy(buf, r.buf[ofs1:ofs1+len1])
+	copy(buf[len1:], r.buf[:len2])
+
+	// Done
+	return bytes.NewReader(buf)
+}
+
+// String returns the unread portion of the buffer as a string without advancing the read-position.
+func (r *RingBuffer) String() string {
+	return string(r.Bytes())
+}
+
+// Read reads up to len(p) bytes from the buffer and stores them in p.
+// It returns the number of bytes read and any error encountered.
+// At the end of the buffer, Read returns 0, io.EOF, or 0, ErrClosed if the buffer was closed,
+// even if p is empty.
+// If SetEOFOnDrain was enabled, the error is also returned along with the last bytes.
+// If a tee writer was set with SetTee and it fails, Read returns the number of bytes consumed
+// from the buffer along with the error returned by the writer.
+func (r *RingBuffer) Read(p []byte) (n int, err error) {
+	r.mtx.Lock()
+	defer r.unlock()
+
+	n, err = r.read(p)
+	if r.tee != nil && n > 0 {
+		// Copy the consumed data to the tee writer.
+		_, teeErr := r.tee.Write(p[:n])
+		if teeErr != nil {
+			err = teeErr
+		}
+	}
 
 	// Done
 	return
 }
 
-// Find returns the index of the first occurrence of b in the unread portion of the buffer,
-// or -1 if b is not present in the buffer.
-func (r *RingBuffer) Find(b byte) int {
+// ReadAtMost behaves like Read but consumes at most max bytes, even if p is larger.
+func (r *RingBuffer) ReadAtMost(p []byte, max int) (n int, err error) {
+	if max < 0 {
+		return 0, errNegativeCount
+	}
+	if max < len(p) {
+		p = p[:max]
+	}
+	return r.Read(p)
+}
+
+// ReadMulti reads from the buffer into all the given slices, in order, as if they were
+// concatenated, until all of them are filled or the buffer is drained. It returns the total
+// number of bytes read. If the buffer is empty, it returns 0, io.EOF, or 0, ErrClosed if the
+// buffer was closed, even if all the parts are empty.
+func (r *RingBuffer) ReadMulti(parts ...[]byte) (n int, err error) {
+	r.mtx.Lock()
+	defer r.unlock()
+
+	if r.written == 0 {
+		return 0, r.eof() // Nothing to read, even if all the parts are empty.
+	}
+
+	for _, part := range parts {
+		if r.written == 0 {
+			break
+		}
+		if len(part) > 0 {
+			read, _ := r.peek(part)
+
+			// Advance the read-position.
+			r.advanceReadPos(read)
+			n += read
+		}
+	}
+
+	// Done
+	return
+}
+
+// TryRead behaves like Read but, if another goroutine is using the buffer, it returns
+// immediately with ok set to false instead of waiting. Errors returned by Read are not
+// reported.
+func (r *RingBuffer) TryRead(p []byte) (n int, ok bool) {
+	if !r.mtx.TryLock() {
+		return 0, false
+	}
+	defer r.unlock()
+
+	n, _ = r.read(p)
+	return n, true
+}
+
+// ReadN reads exactly n bytes from the buffer and returns them in a newly allocated slice.
+// If fewer than n bytes are available, ReadN returns nil and ErrShortRead without consuming
+// any data, so the caller can retry once more data is written.
+func (r *RingBuffer) ReadN(n int) ([]byte, error) {
+	if n < 0 {
+		return nil, errNegativeCount
+	}
+
+	r.mtx.Lock()
+	defer r.unlock()
+
+	if r.written < n {
+		return nil, ErrShortRead
+	}
+	return r.readCopy(n), nil
+}
+
+// Swap reads all the unread data in the buffer, returning it in a newly allocated slice, and
+// writes newData in its place as a single atomic operation. If the buffer was closed, or newData
+// does not fit in the capacity of a bounded buffer or within the maximum size, Swap returns
+// ErrClosed or ErrBufferOverflow and the buffer is left untouched.
+func (r *RingBuffer) Swap(newData []byte) ([]byte, error) {
+	r.mtx.Lock()
+	defer r.unlock()
+
+	if r.closed {
+		return nil, ErrClosed
+	}
+	if len(newData) > r.sizeLimit() {
+		return nil, ErrBufferOverflow
+	}
+
+	old := r.readCopy(r.written)
+
+	// Ensure there is enough space to hold the new data.
+	err := r.ensureCapacity(len(newData))
+	if err != nil {
+		return nil, err // Not reached, the size was already checked.
+	}
+	_, _ = write(r, newData)
+
+	// Done
+	return old, nil
+}
+
+// WriteUint16BE writes v to the buffer as 2 bytes in big-endian order. If the buffer is
+// bounded and there is not enough free space, nothing is written and ErrBufferOverflow is returned.
+func (r *RingBuffer) WriteUint16BE(v uint16) error {
+	var b [2]byte
+
+	binary.BigEndian.PutUint16(b[:], v)
+	return r.writeFixed(b[:])
+}
+
+// ReadUint16BE reads 2 bytes from the buffer and decodes them in big-endian order. If fewer
+// than 2 bytes are available, it returns ErrShortRead without consuming any data.
+func (r *RingBuffer) ReadUint16BE() (uint16, error) {
+	var b [2]byte
+
+	err := r.readFixed(b[:])
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint16(b[:]), nil
+}
+
+// WriteUint16LE writes v to the buffer as 2 bytes in little-endian order. If the buffer is
+// bounded and there is not enough free space, nothing is written and ErrBufferOverflow is returned.
+func (r *RingBuffer) WriteUint16LE(v uint16) error {
+	var b [2]byte
+
+	binary.LittleEndian.PutUint16(b[:], v)
+	return r.writeFixed(b[:])
+}
+
+// ReadUint16LE reads 2 bytes from the buffer and decodes them in little-endian order. If fewer
+// than 2 bytes are available, it returns ErrShortRead without consuming any data.
+func (r *RingBuffer) ReadUint16LE() (uint16, error) {
+	var b [2]byte
+
+	err := r.readFixed(b[:])
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint16(b[:]), nil
+}
+
+// WriteUint32BE writes v to the buffer as 4 bytes in big-endian order. If the buffer is
+// bounded and there is not enough free space, nothing is written and ErrBufferOverflow is returned.
+func (r *RingBuffer) WriteUint32BE(v uint32) error {
+	var b [4]byte
+
+	binary.BigEndian.PutUint32(b[:], v)
+	return r.writeFixed(b[:])
+}
+
+// ReadUint32BE reads 4 bytes from the buffer and decodes them in big-endian order. If fewer
+// than 4 bytes are available, it returns ErrShortRead without consuming any data.
+func (r *RingBuffer) ReadUint32BE() (uint32, error) {
+	var b [4]byte
+
+	err := r.readFixed(b[:])
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(b[:]), nil
+}
+
+// WriteUint32LE writes v to the buffer as 4 bytes in little-endian order. If the buffer is
+// bounded and there is not enough free space, nothing is written and ErrBufferOverflow is returned.
+func (r *RingBuffer) WriteUint32LE(v uint32) error {
+	var b [4]byte
+
+	binary.LittleEndian.PutUint32(b[:], v)
+	return r.writeFixed(b[:])
+}
+
+// ReadUint32LE reads 4 bytes from the buffer and decodes them in little-endian order. If fewer
+// than 4 bytes are available, it returns ErrShortRead without consuming any data.
+func (r *RingBuffer) ReadUint32LE() (uint32, error) {
+	var b [4]byte
+
+	err := r.readFixed(b[:])
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(b[:]), nil
+}
+
+// WriteUint64BE writes v to the buffer as 8 bytes in big-endian order. If the buffer is
+// bounded and there is not enough free space, nothing is written and ErrBufferOverflow is returned.
+func (r *RingBuffer) WriteUint64BE(v uint64) error {
+	var b [8]byte
+
+	binary.BigEndian.PutUint64(b[:], v)
+	return r.writeFixed(b[:])
+}
+
+// ReadUint64BE reads 8 bytes from the buffer and decodes them in big-endian order. If fewer
+// than 8 bytes are available, it returns ErrShortRead without consuming any data.
+func (r *RingBuffer) ReadUint64BE() (uint64, error) {
+	var b [8]byte
+
+	err := r.readFixed(b[:])
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(b[:]), nil
+}
+
+// WriteUint64LE writes v to the buffer as 8 bytes in little-endian order. If the buffer is
+// bounded and there is not enough free space, nothing is written and ErrBufferOverflow is returned.
+func (r *RingBuffer) WriteUint64LE(v uint64) error {
+	var b [8]byte
+
+	binary.LittleEndian.PutUint64(b[:], v)
+	return r.writeFixed(b[:])
+}
+
+// ReadUint64LE reads 8 bytes from the buffer and decodes them in little-endian order. If fewer
+// than 8 bytes are available, it returns ErrShortRead without consuming any data.
+func (r *RingBuffer) ReadUint64LE() (uint64, error) {
+	var b [8]byte
+
+	err := r.readFixed(b[:])
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(b[:]), nil
+}
+
+// WriteRecord writes p to the buffer as a single record, prefixed by a 12-byte header holding
+// its sequence number and length, and returns the sequence number assigned to it. Sequence
+// numbers start at 1 and increase with each record written. Either the whole record is written
+// or nothing at all, so, if the buffer is bounded and there is not enough free space,
+// ErrBufferOverflow is returned.
+// Records must not be mixed with data written by other means.
+func (r *RingBuffer) WriteRecord(p []byte) (seq uint64, err error) {
+	if uint64(len(p)) > math.MaxUint32 {
+		return 0, ErrBufferOverflow
+	}
+
+	r.mtx.Lock()
+	defer r.unlock()
+
+	if r.closed {
+		return 0, ErrClosed
+	}
+
+	// Ensure there is enough space to hold the whole record.
+	err = r.ensureCapacity(recordHeaderSize + len(p))
+	if err != nil {
+		return 0, err
+	}
+
+	// Write the header and the data.
+	var hdr [recordHeaderSize]byte
+
+	seq = r.recordSeq + 1
+	binary.BigEndian.PutUint64(hdr[:8], seq)
+	binary.BigEndian.PutUint32(hdr[8:], uint32(len(p)))
+	_, _ = write(r, hdr[:])
+	_, _ = write(r, p)
+	r.recordSeq = seq
+
+	// Done
+	return
+}
+
+// ReadRecord reads a record written with WriteRecord and returns its sequence number and a copy
+// of its data. If the record is not completely buffered yet, ReadRecord returns ErrShortRead
+// without consuming any data, so the caller can retry once more data is written.
+// If the buffer is empty, ReadRecord returns io.EOF, or ErrClosed if the buffer was closed, and,
+// if the buffer was closed with an incomplete record, it returns io.ErrUnexpectedEOF. On bounded
+// buffers, records larger than the buffer capacity are rejected with an error.
+func (r *RingBuffer) ReadRecord() (seq uint64, data []byte, err error) {
+	var hdr [recordHeaderSize]byte
+
+	r.mtx.Lock()
+	defer r.unlock()
+
+	if r.written == 0 {
+		return 0, nil, r.eof() // Nothing to read.
+	}
+	if r.written < recordHeaderSize {
+		return 0, nil, r.incompleteRecord()
+	}
+
+	// Decode the header and check if the data is available.
+	_, _ = r.peek(hdr[:])
+	seq = binary.BigEndian.Uint64(hdr[:8])
+	size := uint64(binary.BigEndian.Uint32(hdr[8:]))
+	if r.bounded && size > uint64(len(r.buf)-recordHeaderSize) {
+		return 0, nil, errRecordTooLarge // The record can never be completed.
+	}
+	if size > uint64(r.written-recordHeaderSize) {
+		return 0, nil, r.incompleteRecord()
+	}
+
+	// Skip the header and read the data.
+	r.advanceReadPos(recordHeaderSize)
+	data = r.readCopy(int(size))
+
+	// Done
+	return
+}
+
+// ReadAll reads all the unread data in the buffer and returns it in a newly allocated slice.
+func (r *RingBuffer) ReadAll() []byte {
+	r.mtx.Lock()
+	defer r.unlock()
+
+	return r.readCopy(r.written)
+}
+
+// ReadFull reads exactly len(p) bytes from the buffer into p.
+// If not enough data is available, ReadFull blocks until other goroutines write it or
+// the buffer is closed, in which case it returns ErrClosed without consuming any data.
+// If the read deadline is exceeded, it returns os.ErrDeadlineExceeded.
+// It returns io.ErrShortBuffer if p is larger than the amount of data the buffer can hold, that
+// is, the capacity of a bounded buffer or the maximum size of a growable one.
+func (r *RingBuffer) ReadFull(p []byte) (n int, err error) {
+	n = len(p)
+	if n == 0 {
+		return 0, nil
+	}
+
+	r.mtx.Lock()
+	defer r.unlock()
+
+	// Wait until enough data is available.
+	for r.written < n {
+		if n > r.sizeLimit() {
+			return 0, io.ErrShortBuffer
+		}
+		if r.closed {
+			return 0, ErrClosed
+		}
+		if r.readDeadlineExceeded() {
+			return 0, os.ErrDeadlineExceeded
+		}
+		r.wait()
+	}
+
+	// Read from the buffer.
+	_, _ = r.peek(p)
+
+	// Advance the read-position.
+	r.advanceReadPos(n)
+
+	// Done
+	return
+}
+
+// ReadContext reads up to len(p) bytes from the buffer and stores them in p.
+// If the buffer is empty, ReadContext blocks until other goroutines write data, the buffer is
+// closed or the context is done, in which case it returns the context's error.
+// If the read deadline is exceeded, it returns os.ErrDeadlineExceeded.
+func (r *RingBuffer) ReadContext(ctx context.Context, p []byte) (n int, err error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	r.mtx.Lock()
+	defer r.unlock()
+
+	// Wake up the waiting reader if the context is done.
+	stop := context.AfterFunc(ctx, func() {
+		r.mtx.Lock()
+		r.cond.Broadcast()
+		r.mtx.Unlock()
+	})
+	defer stop()
+
+	// Wait until some data is available.
+	for r.written == 0 {
+		if r.closed {
+			return 0, ErrClosed
+		}
+		err = ctx.Err()
+		if err != nil {
+			return 0, err
+		}
+		if r.readDeadlineExceeded() {
+			return 0, os.ErrDeadlineExceeded
+		}
+		r.wait()
+	}
+
+	// Read from the buffer.
+	n, _ = r.peek(p)
+
+	// Advance the read-position.
+	r.advanceReadPos(n)
+
+	// Done
+	return
+}
+
+// Stream starts a goroutine that reads the buffer data, in blocks of up to chunk bytes, as it
+// becomes available and sends a copy of each block through the returned channel. The channel
+// is closed when the context is done or when the buffer is closed and all its data was sent.
+func (r *RingBuffer) Stream(ctx context.Context, chunk int) <-chan []byte {
+	if chunk <= 0 {
+		chunk = minReadSize
+	}
+
+	ch := make(chan []byte)
+	go func() {
+		defer close(ch)
+
+		for {
+			buf := make([]byte, chunk)
+			n, err := r.ReadContext(ctx, buf)
+			if err != nil {
+				return
+			}
+
+			select {
+			case ch <- buf[:n]:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	// Done
+	return ch
+}
+
+// ReadByte reads and returns the next byte from the buffer.
+// At the end of the buffer, ReadByte returns 0, io.EOF, or 0, ErrClosed if the buffer was closed.
+func (r *RingBuffer) ReadByte() (byte, error) {
+	r.mtx.Lock()
+	defer r.unlock()
+
+	if r.written == 0 {
+		return 0, r.eof() // Nothing to read.
+	}
+
+	// Read the byte at the current read-position.
+	b := r.buf[r.readPos]
+
+	// Advance the read-position.
+	r.advanceReadPos(1)
+
+	// Done
+	return b, nil
+}
+
+// ReadRune reads a single UTF-8 encoded Unicode character and returns the rune and its size
+// in bytes. If the encoded rune is invalid, it consumes one byte and returns utf8.RuneError, 1.
+// At the end of the buffer, ReadRune returns 0, 0, io.EOF, or 0, 0, ErrClosed if the buffer
+// was closed.
+// It implements the io.RuneReader interface.
+func (r *RingBuffer) ReadRune() (ch rune, size int, err error) {
+	var buf [utf8.UTFMax]byte
+
+	r.mtx.Lock()
+	defer r.unlock()
+
+	// Peek enough bytes to decode the rune.
+	n, err := r.peek(buf[:])
+	if err != nil {
+		return 0, 0, err
+	}
+	ch, size = utf8.DecodeRune(buf[:n])
+
+	// Advance the read-position.
+	r.advanceReadPos(size)
+
+	// Done
+	return
+}
+
+// LineNotifier returns a writer that writes to the buffer, and a channel that is signaled each
+// time a write through it stores a newline character, so the reader knows a complete line can
+// be read with ReadLine. Signals never block the writer and pending ones are coalesced, so the
+// reader must read all the available lines after each one.
+func (r *RingBuffer) LineNotifier() (io.Writer, <-chan struct{}) {
+	ln := &lineNotifier{
+		rb: r,
+		ch: make(chan struct{}, 1),
+	}
+	return ln, ln.ch
+}
+
+// ReadLine reads until the first newline character in the buffer and returns a copy of the
+// data including the newline. If the buffer does not contain a complete line, ReadLine
+// returns nil, io.EOF, or nil, ErrClosed if the buffer was closed, without consuming any data.
+func (r *RingBuffer) ReadLine() (line []byte, err error) {
+	r.mtx.Lock()
+	defer r.unlock()
+
+	idx := r.find('\n')
+	if idx < 0 {
+		return nil, r.eof()
+	}
+
+	// Read the line.
+	return r.readCopy(idx + 1), nil
+}
+
+// ReadUntil reads until the first occurrence of delim in the buffer and returns a copy of the
+// data including the delimiter. If the delimiter is not present, ReadUntil returns
+// nil, ErrDelimiterNotFound without consuming any data.
+func (r *RingBuffer) ReadUntil(delim byte) ([]byte, error) {
+	r.mtx.Lock()
+	defer r.unlock()
+
+	idx := r.find(delim)
+	if idx < 0 {
+		return nil, ErrDelimiterNotFound
+	}
+
+	// Read the data.
+	return r.readCopy(idx + 1), nil
+}
+
+// ReadUntilBytes reads until the first occurrence of delim in the buffer and returns a copy of
+// the data including the delimiter. If the delimiter is not present, ReadUntilBytes returns
+// nil, ErrDelimiterNotFound without consuming any data.
+func (r *RingBuffer) ReadUntilBytes(delim []byte) ([]byte, error) {
+	if len(delim) == 0 {
+		return nil, errEmptyDelimiter
+	}
+
+	r.mtx.Lock()
+	defer r.unlock()
+
+	idx := r.findBytes(delim)
+	if idx < 0 {
+		return nil, ErrDelimiterNotFound
+	}
+
+	// Read the data.
+	return r.readCopy(idx + len(delim)), nil
+}
+
+// Discard skips the next n bytes from the buffer, returning the number of bytes discarded.
+// If Discard skips fewer than n bytes, it also returns io.EOF.
+func (r *RingBuffer) Discard(n int) (discarded int, err error) {
+	if n < 0 {
+		return 0, errNegativeCount
+	}
+
+	r.mtx.Lock()
+	defer r.unlock()
+
+	discarded = n
+	if discarded > r.written {
+		discarded = r.written
+		err = io.EOF
+	}
+
+	// Advance the read-position.
+	r.advanceReadPos(discarded)
+
+	// Done
+	return
+}
+
+// SkipWhile advances the read-position past the leading bytes that satisfy pred.
+// It returns the number of bytes skipped.
+func (r *RingBuffer) SkipWhile(pred func(byte) bool) int {
+	r.mtx.Lock()
+	defer r.unlock()
+
+	skipped := r.written
+	r.scan(func(elem byte, idx int) bool {
+		if !pred(elem) {
+			skipped = idx
+			return true
+		}
+		return false
+	})
+
+	// Advance the read-position.
+	r.advanceReadPos(skipped)
+
+	// Done
+	return skipped
+}
+
+// Write writes len(p) bytes from p to the buffer.
+// It returns the number of bytes written and an error, if any.
+// Write returns a non-nil error when n != len(p).
+// On bounded buffers, Write stores as much data as it fits and returns io.ErrShortWrite
+// if not all the data could be written.
+// Writing to a closed buffer returns ErrClosed.
+func (r *RingBuffer) Write(p []byte) (n int, err error) {
+	r.mtx.Lock()
+	defer r.unlock()
+
+	return write(r, p)
+}
+
+// WriteGrew behaves like Write but also reports whether the buffer storage was expanded to
+// hold the data.
+func (r *RingBuffer) WriteGrew(p []byte) (n int, grew bool, err error) {
+	r.mtx.Lock()
+	defer r.unlock()
+
+	grows := r.grows
+	n, err = write(r, p)
+	grew = r.grows != grows
+	return
+}
+
+// WriteFull writes all the len(p) bytes from p to the buffer.
+// On bounded buffers, if there is not enough free space, WriteFull blocks until other
+// goroutines read data from the buffer or the buffer is closed, in which case it returns the
+// number of bytes written so far and ErrClosed. On other buffers, it behaves like Write.
+func (r *RingBuffer) WriteFull(p []byte) (n int, err error) {
+	r.mtx.Lock()
+	defer r.unlock()
+
+	if !r.bounded {
+		return write(r, p)
+	}
+	return r.writeFull(p, time.Time{})
+}
+
+// WriteDeadline behaves like WriteFull but, if the deadline t is exceeded while waiting for free
+// space, it returns the number of bytes written so far and os.ErrDeadlineExceeded. A zero value
+// for t means no deadline.
+func (r *RingBuffer) WriteDeadline(p []byte, t time.Time) (n int, err error) {
+	r.mtx.Lock()
+	defer r.unlock()
+
+	if !r.bounded {
+		return write(r, p)
+	}
+
+	// Wake up the waiting writer when the deadline is reached.
+	if !t.IsZero() {
+		timer := time.AfterFunc(time.Until(t), func() {
+			r.mtx.Lock()
+			r.cond.Broadcast()
+			r.mtx.Unlock()
+		})
+		defer timer.Stop()
+	}
+
+	return r.writeFull(p, t)
+}
+
+// TryWrite behaves like Write but, if another goroutine is using the buffer, it returns
+// immediately with ok set to false instead of waiting. Errors returned by Write are not
+// reported but n will be less than len(p).
+func (r *RingBuffer) TryWrite(p []byte) (n int, ok bool) {
+	if !r.mtx.TryLock() {
+		return 0, false
+	}
+	defer r.unlock()
+
+	n, _ = write(r, p)
+	return n, true
+}
+
+// WriteMulti writes the contents of all the given slices to the buffer, in order, as if they
+// were concatenated. It behaves like Write.
+func (r *RingBuffer) WriteMulti(parts ...[]byte) (n int, err error) {
+	total := 0
+	for _, part := range parts {
+		total += len(part)
+		if total < 0 {
+			return 0, ErrBufferOverflow
+		}
+	}
+	if total == 0 {
+		return 0, nil
+	}
+
+	r.mtx.Lock()
+	defer r.unlock()
+
+	if r.closed {
+		return 0, ErrClosed
+	}
+
+	if r.bounded && total > len(r.buf)-r.written {
+		// Write only what fits in the free space.
+		total = len(r.buf) - r.written
+		err = io.ErrShortWrite
+	} else {
+		// Ensure there is enough space to hold all the parts.
+		err = r.ensureCapacity(total)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	for _, part := range parts {
+		if len(part) > total-n {
+			part = part[:total-n]
+		}
+		if len(part) == 0 {
+			continue
+		}
+
+		// Get the writable portion of the buffer.
+		ofs1, len1, len2 := r.writeInfo()
+		if len(part) <= len1 {
+			copy(r.buf[ofs1:ofs1+len(part)], part)
+		} else {
+			copy(r.buf[ofs1:], part[:len1])
+			copy(r.buf[:len2], part[len1:])
+		}
+
+		// Advance the write-position.
+		r.advanceWritePos(len(part))
+		n += len(part)
+	}
+
+	// Done
+	return
+}
+
+// Fill writes count copies of b to the buffer. It behaves like Write.
+func (r *RingBuffer) Fill(b byte, count int) (n int, err error) {
+	if count < 0 {
+		return 0, errNegativeCount
+	}
+	if count == 0 {
+		return 0, nil
+	}
+
+	r.mtx.Lock()
+	defer r.unlock()
+
+	if r.closed {
+		return 0, ErrClosed
+	}
+
+	n = count
+	if r.bounded && n > len(r.buf)-r.written {
+		// Write only what fits in the free space.
+		n = len(r.buf) - r.written
+		err = io.ErrShortWrite
+	} else {
+		// Ensure there is enough space to hold the new data.
+		err = r.ensureCapacity(n)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	r.fill(b, n)
+
+	// Done
+	return
+}
+
+// WriteByteN writes n copies of b to the buffer, like Fill, but as a single operation that either
+// writes all the bytes or none. If the buffer is bounded and there is not enough free space,
+// nothing is written and ErrBufferOverflow is returned.
+func (r *RingBuffer) WriteByteN(b byte, n int) error {
+	if n < 0 {
+		return errNegativeCount
+	}
+
+	r.mtx.Lock()
+	defer r.unlock()
+
+	if r.closed {
+		return ErrClosed
+	}
+
+	// Ensure there is enough space to hold the new data.
+	err := r.ensureCapacity(n)
+	if err != nil {
+		return err
+	}
+	r.fill(b, n)
+
+	// Done
+	return nil
+}
+
+// Reserve writes n zero bytes to the buffer and returns their offset in the unread portion of
+// the buffer, so they can be replaced later using OverwriteAt, for example, to store the length
+// of a frame once its body was written. The offset is no longer valid once data is read from the
+// buffer. If the buffer is bounded and there is not enough free space, nothing is written and
+// ErrBufferOverflow is returned.
+func (r *RingBuffer) Reserve(n int) (offset int, err error) {
+	if n < 0 {
+		return 0, errNegativeCount
+	}
+
+	r.mtx.Lock()
+	defer r.unlock()
+
+	if r.closed {
+		return 0, ErrClosed
+	}
+
+	// Ensure there is enough space to hold the placeholder.
+	err = r.ensureCapacity(n)
+	if err != nil {
+		return 0, err
+	}
+
+	offset = r.written
+	r.fill(0, n)
+
+	// Done
+	return
+}
+
+// WriteString writes the contents of the string s to the buffer without converting it to
+// a byte slice. It behaves like Write.
+func (r *RingBuffer) WriteString(s string) (n int, err error) {
+	r.mtx.Lock()
+	defer r.unlock()
+
+	return write(r, s)
+}
+
+// OverwriteAt replaces len(p) bytes of the unread portion of the buffer, starting at the given
+// offset, with the contents of p. Neither the read-position nor the buffer length change.
+// It returns an error if the range to overwrite exceeds the unread portion of the buffer.
+func (r *RingBuffer) OverwriteAt(offset int, p []byte) (n int, err error) {
+	if offset < 0 {
+		return 0, errNegativeOffset
+	}
+
+	r.mtx.Lock()
+	defer r.unlock()
+
+	n = len(p)
+	if n > r.written-offset {
+		return 0, errOverwriteOutOfRange
+	}
+
+	// Overwrite the data.
+	ofs1, len1, len2 := r.rangeInfo(offset, n)
+	copy(r.buf[ofs1:ofs1+len1], p)
+	copy(r.buf[:len2], p[len1:])
+	r.version += 1
+
+	// Done
+	return
+}
+
+// WriteByte writes a single byte to the buffer.
+// It returns an error if the buffer cannot be expanded.
+func (r *RingBuffer) WriteByte(b byte) error {
+	r.mtx.Lock()
+	defer r.unlock()
+
+	if r.closed {
+		return ErrClosed
+	}
+
+	// Ensure there is enough space to hold the new byte.
+	err := r.ensureCapacity(1)
+	if err != nil {
+		return err
+	}
+
+	// Store the byte at the current write-position.
+	ofs1, _, _ := r.writeInfo()
+	r.buf[ofs1] = b
+
+	// Advance the write-position.
+	r.advanceWritePos(1)
+
+	// Done
+	return nil
+}
+
+// GetWriteSegments ensures the buffer has at least minFree bytes of free space and returns it
+// as two slices that reference the internal storage directly. The second slice is nil if the
+// free space is contiguous. After filling the slices, the caller must call CommitWrite with
+// the number of bytes written, starting from the first slice.
+//
+// WARNING: The returned slices are only valid until the next call that modifies the buffer
+// and must not be used while other goroutines access the buffer.
+func (r *RingBuffer) GetWriteSegments(minFree int) (first []byte, second []byte, err error) {
+	r.mtx.Lock()
+	defer r.unlock()
+
+	if r.closed {
+		return nil, nil, ErrClosed
+	}
+
+	// Ensure there is enough free space.
+	err = r.ensureCapacity(minFree)
+	if err != nil {
+		return
+	}
+
+	ofs1, len1, len2 := r.writeInfo()
+	if len1 > 0 {
+		first = r.buf[ofs1 : ofs1+len1]
+	}
+	if len2 > 0 {
+		second = r.buf[:len2]
+	}
+	return
+}
+
+// CommitWrite advances the write-position by n bytes. It is intended to be used after filling
+// the slices returned by GetWriteSegments.
+// It returns an error if n is negative or greater than the free space of the buffer.
+func (r *RingBuffer) CommitWrite(n int) error {
+	r.mtx.Lock()
+	defer r.unlock()
+
+	if n < 0 || n > len(r.buf)-r.written {
+		return errCommitOutOfRange
+	}
+
+	// Advance the write-position.
+	r.advanceWritePos(n)
+
+	// Done
+	return nil
+}
+
+// ReadFrom reads data from src until io.EOF and appends it to the buffer, growing the buffer
+// as needed. The return value n is the number of bytes read. Any error except io.EOF
+// encountered during the read is also returned. If the buffer cannot hold more data, the
+// data read so far is kept and ErrBufferOverflow is returned.
+// ReadFrom holds the buffer lock across every call to src.Read until it returns io.EOF or an
+// error, so other goroutines using the buffer are blocked meanwhile.
+// It implements the io.ReaderFrom interface.
+func (r *RingBuffer) ReadFrom(src io.Reader) (n int64, err error) {
+	r.mtx.Lock()
+	defer r.unlock()
+
+	if r.closed {
+		return 0, ErrClosed
+	}
+
+	for {
+		var read int
+
+		// Ensure there is some free space to read into. Bounded buffers use whatever
+		// space is left.
+		if !r.bounded || r.written == len(r.buf) {
+			grow := minReadSize
+			if free := r.sizeLimit() - r.written; free < grow {
+				if free == 0 {
+					return n, ErrBufferOverflow
+				}
+				grow = free // Do not ask for more than the maximum size allows.
+			}
+			err = r.ensureCapacity(grow)
+			if err != nil {
+				return
+			}
+		}
+
+		// Read directly into the first writable segment.
+		ofs1, len1, _ := r.writeInfo()
+		read, err = src.Read(r.buf[ofs1 : ofs1+len1])
+		if read < 0 {
+			panic(errNegativeRead)
+		}
+
+		// Advance the write-position.
+		r.advanceWritePos(read)
+		n += int64(read)
+
+		if err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return
+		}
+	}
+}
+
+// WriteReader reads exactly n bytes from src and appends them to the buffer, growing the buffer
+// in advance if needed. Data is read directly into the free space of the buffer. If src ends
+// or fails before n bytes are read, WriteReader returns the number of bytes appended and the
+// error returned by src.
+func (r *RingBuffer) WriteReader(src io.Reader, n int) (written int, err error) {
+	if n < 0 {
+		return 0, errNegativeCount
+	}
+
+	r.mtx.Lock()
+	defer r.unlock()
+
+	if r.closed {
+		return 0, ErrClosed
+	}
+
+	// Ensure there is enough space to hold the new data.
+	err = r.ensureCapacity(n)
+	if err != nil {
+		return
+	}
+
+	for written < n {
+		var read int
+
+		// Read directly into the first writable segment.
+		ofs1, len1, _ := r.writeInfo()
+		if len1 > n-written {
+			len1 = n - written
+		}
+		read, err = src.Read(r.buf[ofs1 : ofs1+len1])
+		if read < 0 {
+			panic(errNegativeRead)
+		}
+
+		// Advance the write-position.
+		r.advanceWritePos(read)
+		written += read
+
+		if err != nil {
+			if written == n {
+				err = nil
+			}
+			return
+		}
+	}
+
+	// Done
+	return
+}
+
+// WriteTo writes the unread portion of the buffer to w until there's no more data to write or
+// an error occurs. The read-position is advanced by the number of bytes accepted by w.
+// It implements the io.WriterTo interface.
+func (r *RingBuffer) WriteTo(w io.Writer) (n int64, err error) {
+	r.mtx.Lock()
+	defer r.unlock()
+
+	var drained int
+
+	drained, err = r.drain(w, r.written)
+	return int64(drained), err
+}
+
+// Drain writes up to n unread bytes to w and advances the read-position by the number of bytes
+// accepted by w. It returns the number of bytes drained, which is less than n if the buffer
+// holds fewer bytes, and the error returned by w, if any, or io.ErrShortWrite if w accepted
+// less data than requested.
+func (r *RingBuffer) Drain(w io.Writer, n int) (int, error) {
+	if n < 0 {
+		return 0, errNegativeCount
+	}
+
+	r.mtx.Lock()
+	defer r.unlock()
+
+	if n > r.written {
+		n = r.written
+	}
+	return r.drain(w, n)
+}
+
+// Pipe moves up to n bytes from the unread portion of src to this buffer, copying directly
+// between the backing arrays. It returns the number of bytes moved, which is less than n if
+// src runs dry. If src is empty, Pipe returns 0, io.EOF, or 0, ErrClosed if src was closed.
+// Like in Write, bounded buffers only receive what fits in the free space and io.ErrShortWrite
+// is returned.
+func (r *RingBuffer) Pipe(src *RingBuffer, n int) (moved int, err error) {
+	if n < 0 {
+		return 0, errNegativeCount
+	}
+	if n == 0 || src == r {
+		return 0, nil
+	}
+
+	lockPair(r, src)
+	defer unlockPair(r, src)
+
+	if src.written == 0 {
+		return 0, src.eof() // Nothing to move.
+	}
+	if n > src.written {
+		n = src.written
+	}
+
+	if r.closed {
+		return 0, ErrClosed
+	}
+	if r.bounded && n > len(r.buf)-r.written {
+		// Move only what fits in the free space.
+		n = len(r.buf) - r.written
+		err = io.ErrShortWrite
+		if n == 0 {
+			return
+		}
+	} else {
+		err = r.ensureCapacity(n)
+		if err != nil {
+			return
+		}
+	}
+
+	// Copy the source segments.
+	ofs1, len1, len2 := src.rangeInfo(0, n)
+	_, _ = write(r, src.buf[ofs1:ofs1+len1])
+	_, _ = write(r, src.buf[:len2])
+
+	// Advance the source read-position.
+	src.advanceReadPos(n)
+
+	// Done
+	moved = n
+	return
+}
+
+// Truncate discards all but the first n unread bytes from the buffer.
+// It panics if n is negative or greater than the length of the unread portion of the buffer.
+func (r *RingBuffer) Truncate(n int) {
+	r.mtx.Lock()
+	defer r.unlock()
+
+	if n < 0 || n > r.written {
+		panic("ringbuffer: truncation out of range")
+	}
+
+	if r.zeroOnRead {
+		// Wipe the discarded data.
+		ofs1, len1, len2 := r.rangeInfo(n, r.written-n)
+		clear(r.buf[ofs1 : ofs1+len1])
+		clear(r.buf[:len2])
+	}
+
+	// Move back the write-position.
+	r.written = n
+	r.version += 1
+	r.consumersTruncated(n)
+}
+
+// Find returns the index of the first occurrence of b in the unread portion of the buffer,
+// or -1 if b is not present in the buffer.
+func (r *RingBuffer) Find(b byte) int {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	return r.find(b)
+}
+
+// FindFrom returns the index of the first occurrence of b in the unread portion of the buffer,
+// starting the search at the given index, or -1 if b is not present from there.
+func (r *RingBuffer) FindFrom(b byte, start int) int {
+	if start < 0 {
+		start = 0
+	}
+
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	if start >= r.written {
+		return -1
+	}
+
+	ofs1, len1, len2 := r.rangeInfo(start, r.written-start)
+	if idx := bytes.IndexByte(r.buf[ofs1:ofs1+len1], b); idx >= 0 {
+		return start + idx
+	}
+	if idx := bytes.IndexByte(r.buf[:len2], b); idx >= 0 {
+		return start + len1 + idx
+	}
+	return -1
+}
+
+// FindLast returns the index of the last occurrence of b in the unread portion of the buffer,
+// or -1 if b is not present in the buffer.
+func (r *RingBuffer) FindLast(b byte) int {
 	foundIdx := -1
 	r.Scan(func(elem byte, idx int) bool {
 		if elem == b {
 			foundIdx = idx
+		}
+		return false
+	})
+	return foundIdx
+}
+
+// Count returns the number of occurrences of b in the unread portion of the buffer.
+func (r *RingBuffer) Count(b byte) int {
+	count := 0
+	r.Scan(func(elem byte, _ int) bool {
+		if elem == b {
+			count += 1
+		}
+		return false
+	})
+	return count
+}
+
+// FindAny returns the index of the first byte in the unread portion of the buffer that is
+// present in set and which byte it is, or -1, 0 if none of them is present in the buffer.
+func (r *RingBuffer) FindAny(set []byte) (idx int, which byte) {
+	var table [256]bool
+
+	for _, b := range set {
+		table[b] = true
+	}
+
+	idx = -1
+	r.Scan(func(elem byte, elemIdx int) bool {
+		if table[elem] {
+			idx = elemIdx
+			which = elem
 			return true
 		}
-		return false
-	})
-	return foundIdx
+		return false
+	})
+	return
+}
+
+// FindBytes returns the index of the first occurrence of the slice b in the unread portion of the buffer,
+// or -1 if b is not present in the buffer.
+func (r *RingBuffer) FindBytes(b []byte) int {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	return r.findBytes(b)
+}
+
+// ReplaceByte replaces all the occurrences of old with new in the unread portion of the buffer.
+// It returns the number of bytes replaced.
+func (r *RingBuffer) ReplaceByte(old, new byte) int {
+	r.mtx.Lock()
+	defer r.unlock()
+
+	count := 0
+	ofs1, len1, len2 := r.readInfo()
+	for _, seg := range [][]byte{r.buf[ofs1 : ofs1+len1], r.buf[:len2]} {
+		for idx := range seg {
+			if seg[idx] == old {
+				seg[idx] = new
+				count += 1
+			}
+		}
+	}
+	if count > 0 {
+		r.version += 1
+	}
+	return count
+}
+
+// Equal reports whether the unread portions of both buffers have the same length and contents.
+func (r *RingBuffer) Equal(other *RingBuffer) bool {
+	if r == other {
+		return true
+	}
+
+	rlockPair(r, other)
+	defer runlockPair(r, other)
+
+	if r.written != other.written {
+		return false
+	}
+	for idx := 0; idx < r.written; idx++ {
+		if r.byteAt(idx) != other.byteAt(idx) {
+			return false
+		}
+	}
+	return true
+}
+
+// Scan calls fn for each byte in the unread portion of the buffer.
+// If the callback returns true, Scan stops the iteration.
+func (r *RingBuffer) Scan(fn func(elem byte, idx int) bool) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	r.scan(fn)
+}
+
+// ScanSnapshot behaves like Scan but iterates over a copy of the unread portion of the buffer
+// taken before the first call to fn, so the buffer is not locked while fn runs and the callback
+// can safely use it. Later modifications of the buffer are not visible to the iteration.
+func (r *RingBuffer) ScanSnapshot(fn func(elem byte, idx int) bool) {
+	for idx, elem := range r.Bytes() {
+		stop := fn(elem, idx)
+		if stop {
+			return
+		}
+	}
+}
+
+// ScanWithLen behaves like Scan but also passes the length of the unread portion of the buffer
+// to the callback, which must not call Len or any other method of the buffer.
+// If the callback returns true, ScanWithLen stops the iteration.
+func (r *RingBuffer) ScanWithLen(fn func(elem byte, idx int, total int) bool) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	total := r.written
+	r.scan(func(elem byte, idx int) bool {
+		return fn(elem, idx, total)
+	})
+}
+
+// ScanReverse calls fn for each byte in the unread portion of the buffer, starting from the
+// most recently written one.
+// If the callback returns true, ScanReverse stops the iteration.
+func (r *RingBuffer) ScanReverse(fn func(elem byte, idx int) bool) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	ofs1, len1, len2 := r.readInfo()
+
+	for idx := len2 - 1; idx >= 0; idx-- {
+		stop := fn(r.buf[idx], len1+idx)
+		if stop {
+			return
+		}
+	}
+	for idx := len1 - 1; idx >= 0; idx-- {
+		stop := fn(r.buf[ofs1+idx], idx)
+		if stop {
+			return
+		}
+	}
+}
+
+// Len returns the number of bytes of the unread portion of the buffer.
+func (r *RingBuffer) Len() int {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	return r.written
+}
+
+// IsEmpty reports whether the buffer has no unread data.
+func (r *RingBuffer) IsEmpty() bool {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	return r.written == 0
+}
+
+// AtEOF reports whether the buffer has no unread data, so Read and Peek will return io.EOF, or
+// ErrClosed if the buffer was closed. It is equivalent to IsEmpty.
+func (r *RingBuffer) AtEOF() bool {
+	return r.IsEmpty()
+}
+
+// IsFull reports whether the buffer has no free space left, so the next write will
+// expand the buffer or, in bounded buffers, fail.
+func (r *RingBuffer) IsFull() bool {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	return r.written == len(r.buf)
+}
+
+// Cap returns the capacity of the buffer, that is, the total space allocated for the buffer's data.
+func (r *RingBuffer) Cap() int {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	return len(r.buf)
+}
+
+// Available returns how many bytes can be written to the buffer before it needs to grow.
+func (r *RingBuffer) Available() int {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	return len(r.buf) - r.written
+}
+
+// Grow grows the buffer, if needed, to guarantee space for another n bytes. After Grow(n),
+// at least n bytes can be written to the buffer without another allocation.
+// It returns ErrBufferOverflow if the buffer cannot grow that much.
+func (r *RingBuffer) Grow(n int) error {
+	if n < 0 {
+		return errNegativeCount
+	}
+
+	r.mtx.Lock()
+	defer r.unlock()
+
+	return r.ensureCapacity(n)
+}
+
+// Shrink releases unused storage when the unread data occupies less than a quarter of the
+// buffer capacity. The new capacity is the next power of two that can hold the unread data,
+// but never less than the grow size. Buffers created with NewWithGrowStep or NewExact keep
+// their linear capacities instead, so they are shrunk to the smallest one that can hold the
+// unread data. Bounded buffers are never shrunk.
+func (r *RingBuffer) Shrink() {
+	r.mtx.Lock()
+	defer r.unlock()
+
+	r.shrink()
+}
+
+func (r *RingBuffer) shrink() {
+	if r.bounded || r.written >= len(r.buf)/4 {
+		return
+	}
+
+	var newSize int
+	if r.linearBase > 0 {
+		// Round up to the initial capacity plus a multiple of the grow size.
+		newSize = r.linearBase
+		if r.written > newSize {
+			newSize += (r.written - newSize + r.growSize - 1) / r.growSize * r.growSize
+		}
+	} else {
+		newSize = nextPowerOfTwo(r.written)
+		if newSize < r.growSize {
+			newSize = r.growSize
+		}
+	}
+	if newSize < len(r.buf) {
+		r.resizeBuffer(newSize)
+	}
+}
+
+// Rewind moves back the read-position by n bytes, so already read data can be read again.
+// It fails if any of the n bytes was overwritten by later writes or is no longer present because
+// the buffer storage was reallocated, reset or compacted.
+// Consumers are not affected.
+func (r *RingBuffer) Rewind(n int) error {
+	if n < 0 {
+		return errNegativeCount
+	}
+
+	r.mtx.Lock()
+	defer r.unlock()
+
+	if n > r.rewindable {
+		return errRewindOutOfRange
+	}
+
+	// Move back the read-position.
+	r.readPos -= n
+	if r.readPos < 0 {
+		r.readPos += len(r.buf)
+	}
+	r.written += n
+	r.rewindable -= n
+	r.version += 1
+	for _, c := range r.consumers {
+		c.offset += n
+	}
+
+	// Wake up blocked readers.
+	r.cond.Broadcast()
+
+	// Done
+	return nil
+}
+
+// History returns a copy of up to the last n bytes already read from the buffer that are still
+// intact, in the order they were read. Like in Rewind, data overwritten by later writes or lost
+// because the buffer storage was reallocated, reset or compacted is not available.
+func (r *RingBuffer) History(n int) []byte {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	if n > r.rewindable {
+		n = r.rewindable
+	}
+	if n <= 0 {
+		return nil
+	}
+
+	// Copy the data before the read-position.
+	start := r.readPos - n
+	if start < 0 {
+		start += len(r.buf)
+	}
+	buf := make([]byte, n)
+	if start+n <= len(r.buf) {
+		copy(buf, r.buf[start:start+n])
+	} else {
+		len1 := len(r.buf) - start
+		copy(buf, r.buf[start:])
+		copy(buf[len1:], r.buf[:n-len1])
+	}
+
+	// Done
+	return buf
+}
+
+// Compact moves the unread data to the start of the backing array, so it becomes contiguous
+// and PeekSegments returns a nil second slice. No memory is allocated.
+func (r *RingBuffer) Compact() {
+	r.mtx.Lock()
+	defer r.unlock()
+
+	if r.readPos+r.written <= len(r.buf) {
+		copy(r.buf, r.buf[r.readPos:r.readPos+r.written])
+		if r.zeroOnRead && r.readPos > 0 {
+			// Wipe the vacated tail so the unread data is not left behind in the free space.
+			clear(r.buf[r.written : r.readPos+r.written])
+		}
+	} else {
+		// Rotate the whole backing array in place.
+		reverseBytes(r.buf[:r.readPos])
+		reverseBytes(r.buf[r.readPos:])
+		reverseBytes(r.buf)
+	}
+	r.readPos = 0
+	r.rewindable = 0
+	r.version += 1
+}
+
+// Close closes the buffer. Blocked readers are woken up and subsequent writes fail with
+// ErrClosed. Already buffered data can still be read and, once drained, reads return
+// ErrClosed instead of io.EOF.
+func (r *RingBuffer) Close() error {
+	r.mtx.Lock()
+	defer r.unlock()
+
+	r.closed = true
+
+	// Wake up blocked readers.
+	r.cond.Broadcast()
+
+	// Done
+	return nil
+}
+
+// Validate checks the internal state of the buffer and returns an error describing the first
+// violated invariant, if any. It is useful to verify a buffer restored by external means.
+// Once the buffer was expanded, its capacity must not be smaller than the grow size unless it
+// reached the maximum size or was shrunk back to the initial capacity of NewWithGrowStep.
+// Buffers that never grew are exempt because NewWithCapacity and NewWithGrowStep accept a
+// smaller initial capacity. The capacity is not checked against the
+// maximum size, because SetMaxSize does not shrink an already allocated buffer, nor against
+// the grow policy, since a custom grow strategy may pick any size.
+func (r *RingBuffer) Validate() error {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	if r.growSize < minGrowSize || r.growSize > maxGrowSize {
+		return errInvalidGrowSize
+	}
+	if len(r.buf) == 0 {
+		return errInvalidCapacity
+	}
+	if r.grows > 0 && len(r.buf) < r.growSize && len(r.buf) != r.maxSize && len(r.buf) != r.linearBase {
+		return errInvalidCapacity
+	}
+	if r.readPos < 0 || r.readPos >= len(r.buf) {
+		return errInvalidReadPos
+	}
+	if r.written < 0 || r.written > len(r.buf) {
+		return errInvalidWritten
+	}
+	for _, c := range r.consumers {
+		if c.offset < 0 || c.offset > r.written {
+			return errInvalidConsumer
+		}
+	}
+
+	// Done
+	return nil
 }
 
-// FindBytes returns the index of the first occurrence of the slice b in the unread portion of the buffer,
-// or -1 if b is not present in the buffer.
-func (r *RingBuffer) FindBytes(b []byte) int {
-	if len(b) == 0 {
-		return -1
-	}
+// Stats returns the number of bytes written to and read from the buffer during its lifetime,
+// and the number of times the buffer was expanded. Discarded data is accounted as read.
+func (r *RingBuffer) Stats() (totalWritten uint64, totalRead uint64, grows int) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
 
-	foundIdx := -1
-	currentOfs := 0
-	potentialStartIdx := -1
-	r.Scan(func(elem byte, idx int) bool {
-		if elem == b[currentOfs] {
-			if currentOfs == 0 {
-				potentialStartIdx = idx
-			}
-			currentOfs += 1
-			if currentOfs == len(b) {
-				foundIdx = potentialStartIdx
-				return true
-			}
-		} else {
-			currentOfs = 0
-		}
-		return false
-	})
-	return foundIdx
+	return r.totalWritten, r.totalRead, r.grows
 }
 
-// Scan calls fn for each byte in the unread portion of the buffer.
-// If the callback returns false, Scan stops the iteration.
-func (r *RingBuffer) Scan(fn func(elem byte, idx int) bool) {
+// AllocBytes returns the total size of the backing arrays allocated to expand the buffer during
+// its lifetime. Together with Stats, it allows measuring the cost of a given grow size.
+func (r *RingBuffer) AllocBytes() uint64 {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	return r.allocBytes
+}
+
+// Reset discards all the unread data in the buffer but keeps the allocated storage for
+// future writes.
+func (r *RingBuffer) Reset() {
 	r.mtx.Lock()
-	defer r.mtx.Unlock()
+	defer r.unlock()
 
+	if r.zeroOnRead {
+		clear(r.buf)
+	}
+	r.readPos = 0
+	r.written = 0
+	r.rewindable = 0
+	r.version += 1
+	r.consumersTruncated(0)
+}
+
+func (r *RingBuffer) scan(fn func(elem byte, idx int) bool) {
 	ofs1, len1, len2 := r.readInfo()
 
 	for idx := 0; idx < len1; idx++ {
@@ -180,12 +2378,42 @@ func (r *RingBuffer) Scan(fn func(elem byte, idx int) bool) {
 	}
 }
 
-// Len returns the number of bytes of the unread portion of the buffer.
-func (r *RingBuffer) Len() int {
-	r.mtx.Lock()
-	defer r.mtx.Unlock()
+func (r *RingBuffer) find(b byte) int {
+	foundIdx := -1
+	r.scan(func(elem byte, idx int) bool {
+		if elem == b {
+			foundIdx = idx
+			return true
+		}
+		return false
+	})
+	return foundIdx
+}
 
-	return r.written
+func (r *RingBuffer) findBytes(b []byte) int {
+	if len(b) == 0 {
+		return -1
+	}
+
+	for startIdx := 0; startIdx <= r.written-len(b); startIdx++ {
+		currentOfs := 0
+		for currentOfs < len(b) && r.byteAt(startIdx+currentOfs) == b[currentOfs] {
+			currentOfs += 1
+		}
+		if currentOfs == len(b) {
+			return startIdx
+		}
+	}
+	return -1
+}
+
+// byteAt returns the byte located at the given offset of the unread portion of the buffer.
+func (r *RingBuffer) byteAt(idx int) byte {
+	pos := r.readPos + idx
+	if pos >= len(r.buf) {
+		pos -= len(r.buf)
+	}
+	return r.buf[pos]
 }
 
 func (r *RingBuffer) readInfo() (ofs1 int, len1 int, len2 int) {
@@ -199,11 +2427,29 @@ func (r *RingBuffer) readInfo() (ofs1 int, len1 int, len2 int) {
 	return
 }
 
+// rangeInfo returns the location in the backing array of n bytes starting at the given offset
+// of the unread portion of the buffer.
+func (r *RingBuffer) rangeInfo(offset int, n int) (ofs1 int, len1 int, len2 int) {
+	ofs1 = r.readPos + offset
+	if ofs1 >= len(r.buf) {
+		ofs1 -= len(r.buf)
+	}
+	if ofs1+n <= len(r.buf) {
+		len1 = n
+	} else {
+		len1 = len(r.buf) - ofs1
+		len2 = n - len1
+	}
+	return
+}
+
 func (r *RingBuffer) writeInfo() (ofs1 int, len1 int, len2 int) {
 	if r.written == len(r.buf) {
 		return
 	}
 	if r.readPos < len(r.buf)-r.written {
+		// The unread data does not wrap, so the free space is the tail after it and the
+		// prefix before the read-position.
 		end := r.readPos + r.written
 		ofs1 = end
 		len1 = len(r.buf) - end
@@ -211,20 +2457,62 @@ func (r *RingBuffer) writeInfo() (ofs1 int, len1 int, len2 int) {
 			len2 = r.readPos
 		}
 	} else {
+		// The unread data wraps or ends exactly at the end of the array, so the free space
+		// is the single gap between the end of the data and the read-position.
 		ofs1 = r.readPos - (len(r.buf) - r.written)
 		len1 = len(r.buf) - r.written
 	}
 	return
 }
 
+// sizeLimit returns the maximum amount of data the buffer can hold.
+func (r *RingBuffer) sizeLimit() int {
+	if r.bounded {
+		return len(r.buf)
+	}
+	limit := r.maxSize
+	if limit <= 0 {
+		limit = defaultMaxSize
+	}
+	if limit < len(r.buf) {
+		limit = len(r.buf) // The buffer was not shrunk when the limit was set.
+	}
+	return limit
+}
+
 func (r *RingBuffer) ensureCapacity(n int) error {
 	if n > len(r.buf)-r.written {
+		if r.bounded {
+			return ErrBufferOverflow
+		}
+		limit := r.maxSize
+		if limit <= 0 {
+			limit = defaultMaxSize
+		}
 		required := r.written + n
-		if required < n {
-			return errors.New("buffer overflow")
+		if required < n || required > limit {
+			return ErrBufferOverflow
+		}
+		var newSize int
+
+		if r.growFn != nil {
+			// Let the grow strategy compute the new size.
+			newSize = r.growFn(len(r.buf), required)
+			if newSize < required {
+				newSize = required
+			} else if newSize > limit {
+				newSize = limit
+			}
+		} else {
+			// Grow the current size in steps of growSize.
+			newSize = required
+			if rem := (required - len(r.buf)) % r.growSize; rem != 0 {
+				newSize += r.growSize - rem
+				if newSize < required || newSize > limit {
+					newSize = limit
+				}
+			}
 		}
-		rem := required % r.growSize
-		newSize := required + (r.growSize - rem)
 		r.growBuffer(newSize)
 	}
 	return nil
@@ -232,35 +2520,93 @@ func (r *RingBuffer) ensureCapacity(n int) error {
 
 func (r *RingBuffer) growBuffer(newSize int) {
 	if newSize > len(r.buf) {
-		newBuf := make([]byte, newSize)
+		r.resizeBuffer(newSize)
+		r.grows += 1
+		r.allocBytes += uint64(newSize)
+	}
+}
 
-		if r.readPos+r.written <= len(r.buf) {
-			copy(newBuf, r.buf[r.readPos:r.readPos+r.written])
-		} else {
-			temp := len(r.buf) - r.readPos
-			copy(newBuf, r.buf[r.readPos:])
-			copy(newBuf[temp:], r.buf[:r.written-temp])
-		}
+// resizeBuffer moves the unread data to the start of a new backing array of the given size.
+// The new size must be large enough to hold the unread data.
+func (r *RingBuffer) resizeBuffer(newSize int) {
+	newBuf := make([]byte, newSize)
 
-		r.buf = newBuf
-		r.readPos = 0
+	if r.readPos+r.written <= len(r.buf) {
+		copy(newBuf, r.buf[r.readPos:r.readPos+r.written])
+	} else {
+		temp := len(r.buf) - r.readPos
+		copy(newBuf, r.buf[r.readPos:])
+		copy(newBuf[temp:], r.buf[:r.written-temp])
 	}
+	if r.zeroOnRead {
+		// Wipe the old storage before releasing it.
+		clear(r.buf)
+	}
+
+	r.buf = newBuf
+	r.readPos = 0
+	r.rewindable = 0
+	r.version += 1
 }
 
 func (r *RingBuffer) advanceReadPos(n int) {
-	if r.readPos < len(r.buf)-n {
-		r.readPos += n
-	} else {
-		r.readPos -= len(r.buf) - n
+	if r.zeroOnRead {
+		// Wipe the consumed data.
+		ofs1, len1, len2 := r.rangeInfo(0, n)
+		clear(r.buf[ofs1 : ofs1+len1])
+		clear(r.buf[:len2])
+	}
+
+	// NOTE: Consuming exactly the remaining contiguous tail moves the read-position
+	//       back to the start of the backing array.
+	r.readPos += n
+	if r.readPos >= len(r.buf) {
+		r.readPos -= len(r.buf)
 	}
 	r.written -= n
+	r.version += 1
+	if !r.zeroOnRead {
+		r.rewindable += n
+		if r.rewindable > len(r.buf)-r.written {
+			r.rewindable = len(r.buf) - r.written
+		}
+	} else {
+		r.rewindable = 0
+	}
+	r.totalRead += uint64(n)
+	if r.onRead != nil {
+		r.readPending += n
+	}
+	r.consumersAdvanced(n)
+
+	// Wake up blocked writers.
+	r.cond.Broadcast()
 }
 
 func (r *RingBuffer) advanceWritePos(n int) {
+	if r.flushWatermark > 0 && r.written < r.flushWatermark && r.written+n >= r.flushWatermark {
+		r.flushPending = true
+	}
 	r.written += n
+	r.version += 1
+	if r.rewindable > len(r.buf)-r.written {
+		// The new data overwrote the oldest already read bytes.
+		r.rewindable = len(r.buf) - r.written
+	}
+	r.totalWritten += uint64(n)
+	if r.onWrite != nil {
+		r.writePending += n
+	}
+
+	// Wake up blocked readers.
+	r.cond.Broadcast()
 }
 
 func (r *RingBuffer) peek(buf []byte) (int, error) {
+	if r.written == 0 {
+		return 0, r.eof() // Nothing to read, even if buf is empty.
+	}
+
 	n := len(buf)
 	if n == 0 {
 		return 0, nil
@@ -268,19 +2614,362 @@ func (r *RingBuffer) peek(buf []byte) (int, error) {
 
 	ofs1, len1, len2 := r.readInfo()
 
-	if len1 == 0 && len2 == 0 {
-		return 0, io.EOF // Nothing to read.
-	}
-
 	if n <= len1 {
 		copy(buf, r.buf[ofs1:ofs1+n])
 	} else {
 		if n > len1+len2 {
 			n = len1 + len2
 		}
-		copy(buf, r.buf[ofs1:])
+		copy(buf, r.buf[ofs1:ofs1+len1])
 		copy(buf[len1:], r.buf[:len2])
 	}
 
 	return n, nil
 }
+
+func (r *RingBuffer) read(p []byte) (n int, err error) {
+	// Read from the buffer.
+	n, err = r.peek(p)
+	if err == nil {
+		// Advance the read-position.
+		r.advanceReadPos(n)
+
+		if r.eofOnDrain && n > 0 && r.written == 0 {
+			err = r.eof()
+		}
+	}
+
+	// Shrink the buffer after sustained low usage.
+	if r.autoShrinkReads > 0 && n > 0 {
+		if r.written < len(r.buf)/4 {
+			r.idleReads += 1
+			if r.idleReads > r.autoShrinkReads {
+				r.shrink()
+				r.idleReads = 0
+			}
+		} else {
+			r.idleReads = 0
+		}
+	}
+	return
+}
+
+func (r *RingBuffer) drain(w io.Writer, n int) (drained int, err error) {
+	ofs1, len1, len2 := r.rangeInfo(0, n)
+
+	// Write the first segment.
+	if len1 > 0 {
+		var written int
+
+		written, err = w.Write(r.buf[ofs1 : ofs1+len1])
+		r.advanceReadPos(written)
+		drained = written
+		if err == nil && written != len1 {
+			err = io.ErrShortWrite
+		}
+		if err != nil {
+			return
+		}
+	}
+
+	// And the second one.
+	if len2 > 0 {
+		var written int
+
+		written, err = w.Write(r.buf[:len2])
+		r.advanceReadPos(written)
+		drained += written
+		if err == nil && written != len2 {
+			err = io.ErrShortWrite
+		}
+	}
+
+	// Done
+	return
+}
+
+func (r *RingBuffer) writeFull(p []byte, deadline time.Time) (n int, err error) {
+	for n < len(p) {
+		var written int
+
+		// Wait until some space is available.
+		for r.written == len(r.buf) {
+			if r.closed {
+				return n, ErrClosed
+			}
+			if !deadline.IsZero() && !time.Now().Before(deadline) {
+				return n, os.ErrDeadlineExceeded
+			}
+			r.wait()
+		}
+
+		// Write as much as it fits.
+		written, err = write(r, p[n:])
+		n += written
+		if err != nil && err != io.ErrShortWrite {
+			return
+		}
+		err = nil
+	}
+
+	// Done
+	return
+}
+
+// fill writes n copies of b to the free space of the buffer, which must be large enough.
+func (r *RingBuffer) fill(b byte, n int) {
+	// Fill the writable portion of the buffer.
+	ofs1, len1, len2 := r.writeInfo()
+	if n < len1 {
+		len1 = n
+	}
+	if n-len1 < len2 {
+		len2 = n - len1
+	}
+	for _, seg := range [][]byte{r.buf[ofs1 : ofs1+len1], r.buf[:len2]} {
+		for idx := range seg {
+			seg[idx] = b
+		}
+	}
+
+	// Advance the write-position.
+	r.advanceWritePos(n)
+}
+
+// writeFixed writes all of p to the buffer or nothing at all.
+func (r *RingBuffer) writeFixed(p []byte) error {
+	r.mtx.Lock()
+	defer r.unlock()
+
+	if r.bounded && len(p) > len(r.buf)-r.written {
+		if r.closed {
+			return ErrClosed
+		}
+		return ErrBufferOverflow
+	}
+	_, err := write(r, p)
+	return err
+}
+
+// readFixed fills p from the buffer or reads nothing at all.
+func (r *RingBuffer) readFixed(p []byte) error {
+	r.mtx.Lock()
+	defer r.unlock()
+
+	if r.written < len(p) {
+		return ErrShortRead
+	}
+	_, _ = r.peek(p)
+
+	// Advance the read-position.
+	r.advanceReadPos(len(p))
+
+	// Done
+	return nil
+}
+
+func (r *RingBuffer) incompleteRecord() error {
+	if r.closed {
+		return io.ErrUnexpectedEOF // The rest of the record will never be written.
+	}
+	return ErrShortRead
+}
+
+func (r *RingBuffer) readCopy(n int) []byte {
+	buf := make([]byte, n)
+	_, _ = r.peek(buf)
+
+	// Advance the read-position.
+	r.advanceReadPos(n)
+
+	// Done
+	return buf
+}
+
+func (r *RingBuffer) readDeadlineExceeded() bool {
+	return !r.readDeadline.IsZero() && !time.Now().Before(r.readDeadline)
+}
+
+func (r *RingBuffer) eof() error {
+	if r.closed {
+		return ErrClosed
+	}
+	return io.EOF
+}
+
+// lineNotifier is the writer returned by LineNotifier.
+type lineNotifier struct {
+	rb *RingBuffer
+	ch chan struct{}
+}
+
+func (ln *lineNotifier) Write(p []byte) (n int, err error) {
+	n, err = ln.rb.Write(p)
+	if bytes.IndexByte(p[:n], '\n') >= 0 {
+		// Signal the reader without blocking.
+		select {
+		case ln.ch <- struct{}{}:
+		default:
+		}
+	}
+	return
+}
+
+// pendingHooks holds the hook calls deferred until the buffer lock is released.
+type pendingHooks struct {
+	onRead  func(n int)
+	onWrite func(n int)
+	onFlush func()
+	read    int
+	written int
+}
+
+func (h *pendingHooks) call() {
+	if h.onRead != nil {
+		h.onRead(h.read)
+	}
+	if h.onWrite != nil {
+		h.onWrite(h.written)
+	}
+	if h.onFlush != nil {
+		h.onFlush()
+	}
+}
+
+// errorReader is a reader that always fails with the given error.
+type errorReader struct {
+	err error
+}
+
+func (er *errorReader) Read(_ []byte) (int, error) {
+	return 0, er.err
+}
+
+// unlock releases the exclusive lock and then calls the hooks for the data transferred while it
+// was held.
+func (r *RingBuffer) unlock() {
+	h := r.takeHooks()
+	r.mtx.Unlock()
+
+	// Notify the hooks outside the lock.
+	h.call()
+}
+
+// wait waits until the buffer is signaled. If any hook is pending, it is called instead, after
+// temporarily releasing the lock, so the caller must check its condition again.
+func (r *RingBuffer) wait() {
+	if r.readPending > 0 || r.writePending > 0 || r.flushPending {
+		r.unlock()
+		r.mtx.Lock()
+		return
+	}
+	r.cond.Wait()
+}
+
+// takeHooks returns the pending hook calls and resets them. The lock must be held.
+func (r *RingBuffer) takeHooks() (h pendingHooks) {
+	if r.readPending > 0 {
+		h.onRead, h.read = r.onRead, r.readPending
+		r.readPending = 0
+	}
+	if r.writePending > 0 {
+		h.onWrite, h.written = r.onWrite, r.writePending
+		r.writePending = 0
+	}
+	if r.flushPending {
+		h.onFlush = r.onFlush
+		r.flushPending = false
+	}
+	return
+}
+
+// rlockPair locks both buffers for reading always in the same order to avoid deadlocks.
+func rlockPair(r1 *RingBuffer, r2 *RingBuffer) {
+	if uintptr(unsafe.Pointer(r1)) > uintptr(unsafe.Pointer(r2)) {
+		r1, r2 = r2, r1
+	}
+	r1.mtx.RLock()
+	r2.mtx.RLock()
+}
+
+func runlockPair(r1 *RingBuffer, r2 *RingBuffer) {
+	r1.mtx.RUnlock()
+	r2.mtx.RUnlock()
+}
+
+// lockPair locks both buffers always in the same order to avoid deadlocks.
+func lockPair(r1 *RingBuffer, r2 *RingBuffer) {
+	if uintptr(unsafe.Pointer(r1)) > uintptr(unsafe.Pointer(r2)) {
+		r1, r2 = r2, r1
+	}
+	r1.mtx.Lock()
+	r2.mtx.Lock()
+}
+
+func unlockPair(r1 *RingBuffer, r2 *RingBuffer) {
+	h1 := r1.takeHooks()
+	h2 := r2.takeHooks()
+	r1.mtx.Unlock()
+	r2.mtx.Unlock()
+
+	// Notify the hooks outside the locks.
+	h1.call()
+	h2.call()
+}
+
+func reverseBytes(buf []byte) {
+	for i, j := 0, len(buf)-1; i < j; i, j = i+1, j-1 {
+		buf[i], buf[j] = buf[j], buf[i]
+	}
+}
+
+func nextPowerOfTwo(n int) int {
+	if n <= 1 {
+		return 1
+	}
+	return 1 << bits.Len(uint(n-1))
+}
+
+// write implements Write and WriteString.
+func write[T []byte | string](r *RingBuffer, p T) (n int, err error) {
+	n = len(p)
+	if n == 0 {
+		return 0, nil
+	}
+
+	if r.closed {
+		return 0, ErrClosed
+	}
+
+	if r.bounded && n > len(r.buf)-r.written {
+		// Write only what fits in the free space.
+		n = len(r.buf) - r.written
+		err = io.ErrShortWrite
+		if n == 0 {
+			return
+		}
+		p = p[:n]
+	} else {
+		// Ensure there is enough space to hold the new data.
+		err = r.ensureCapacity(n)
+		if err != nil {
+			n = 0
+			return
+		}
+	}
+
+	// Get the writable portion of the buffer.
+	ofs1, len1, len2 := r.writeInfo()
+	if n <= len1 {
+		copy(r.buf[ofs1:ofs1+n], p)
+	} else {
+		copy(r.buf[ofs1:], p[:len1])
+		copy(r.buf[:len2], p[len1:])
+	}
+
+	// Advance the write-position.
+	r.advanceWritePos(n)
+
+	// Done
+	return
+}
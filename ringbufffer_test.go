@@ -2,8 +2,19 @@ package ringbuffer_test
 
 import (
 	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"hash/crc32"
 	"io"
+	"math"
+	"os"
+	"strings"
 	"testing"
+	"testing/iotest"
+	"time"
+	"unicode/utf8"
 
 	"github.com/mxmauro/ringbuffer"
 )
@@ -102,3 +113,2897 @@ func (trb *testRingBuffer) checkLen(expected int) {
 		trb.t.Fatal("unexpected buffer length")
 	}
 }
+
+func TestWriteByte(t *testing.T) {
+	rb := ringbuffer.New(16)
+
+	// Move the read-position to the last byte of the backing array.
+	_, _ = rb.Write(make([]byte, 15))
+	_, _ = rb.Read(make([]byte, 15))
+
+	// The first byte lands at the end of the array and the second one wraps.
+	for _, b := range []byte("ab") {
+		if err := rb.WriteByte(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf [2]byte
+	n, err := rb.Read(buf[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 || string(buf[:]) != "ab" {
+		t.Fatal("invalid data read")
+	}
+}
+
+func TestReadByte(t *testing.T) {
+	rb := ringbuffer.New(16)
+
+	// Create a wrapped buffer.
+	_, _ = rb.Write(make([]byte, 12))
+	_, _ = rb.Read(make([]byte, 12))
+	_, _ = rb.Write([]byte("0123456789"))
+
+	for _, expected := range []byte("0123456789") {
+		b, err := rb.ReadByte()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b != expected {
+			t.Fatal("invalid data read")
+		}
+	}
+
+	_, err := rb.ReadByte()
+	if err != io.EOF {
+		t.Fatal("expected EOF")
+	}
+}
+
+type limitedWriter struct {
+	buf   bytes.Buffer
+	limit int
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	if len(p) > w.limit {
+		p = p[:w.limit]
+	}
+	w.limit -= len(p)
+	return w.buf.Write(p)
+}
+
+func TestWriteTo(t *testing.T) {
+	rb := ringbuffer.New(16)
+
+	// Create a wrapped buffer.
+	_, _ = rb.Write(make([]byte, 12))
+	_, _ = rb.Read(make([]byte, 12))
+	_, _ = rb.Write([]byte("0123456789"))
+
+	// The writer only accepts part of the second segment.
+	w := &limitedWriter{
+		limit: 6,
+	}
+	n, err := rb.WriteTo(w)
+	if err != io.ErrShortWrite {
+		t.Fatal("expected short write")
+	}
+	if n != 6 || w.buf.String() != "012345" {
+		t.Fatal("invalid data written")
+	}
+	if rb.Len() != 4 {
+		t.Fatal("unexpected buffer length")
+	}
+
+	// Drain the rest.
+	w.limit = 100
+	n, err = rb.WriteTo(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 4 || w.buf.String() != "0123456789" {
+		t.Fatal("invalid data written")
+	}
+	if rb.Len() != 0 {
+		t.Fatal("unexpected buffer length")
+	}
+}
+
+type chunkedReader struct {
+	data  []byte
+	chunk int
+}
+
+func (cr *chunkedReader) Read(p []byte) (int, error) {
+	if len(cr.data) == 0 {
+		return 0, io.EOF
+	}
+	n := cr.chunk
+	if n > len(p) {
+		n = len(p)
+	}
+	if n > len(cr.data) {
+		n = len(cr.data)
+	}
+	copy(p, cr.data[:n])
+	cr.data = cr.data[n:]
+	return n, nil
+}
+
+func TestReadFrom(t *testing.T) {
+	rb := ringbuffer.New(1024)
+
+	// Move the read-position near the end of the backing array.
+	_, _ = rb.Write(make([]byte, 1000))
+	_, _ = rb.Read(make([]byte, 1000))
+
+	data := bytes.Repeat([]byte("0123456789abcdefghi"), 100)
+	n, err := rb.ReadFrom(&chunkedReader{
+		data:  data,
+		chunk: 7,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(data)) {
+		t.Fatal("read data length mismatch")
+	}
+
+	buf := make([]byte, len(data))
+	nr, _ := rb.Read(buf)
+	if nr != len(data) || !bytes.Equal(buf, data) {
+		t.Fatal("invalid data read")
+	}
+
+	// Fill up to the maximum size.
+	rb = ringbuffer.New(16)
+	rb.SetMaxSize(100)
+	n, err = rb.ReadFrom(bytes.NewReader(data))
+	if err != ringbuffer.ErrBufferOverflow {
+		t.Fatal("expected buffer overflow")
+	}
+	if n != 100 || !bytes.Equal(rb.Bytes(), data[:100]) {
+		t.Fatal("invalid data read")
+	}
+}
+
+func TestReset(t *testing.T) {
+	rb := ringbuffer.New(16)
+
+	_, _ = rb.Write([]byte("0123456789"))
+	_, _ = rb.Read(make([]byte, 4))
+
+	rb.Reset()
+	if rb.Len() != 0 {
+		t.Fatal("unexpected buffer length")
+	}
+
+	_, _ = rb.Write(testData)
+	if rb.Cap() != 16 {
+		t.Fatal("unexpected buffer capacity")
+	}
+	var buf [5]byte
+	n, _ := rb.Read(buf[:])
+	if n != len(testData) || !bytes.Equal(buf[:], testData) {
+		t.Fatal("invalid data read")
+	}
+}
+
+func TestCap(t *testing.T) {
+	rb := ringbuffer.New(16)
+	if rb.Cap() != 16 {
+		t.Fatal("unexpected buffer capacity")
+	}
+
+	// The buffer grows in multiples of the grow size.
+	_, _ = rb.Write(make([]byte, 20))
+	if rb.Cap() != 32 {
+		t.Fatal("unexpected buffer capacity")
+	}
+	_, _ = rb.Write(make([]byte, 20))
+	if rb.Cap() != 48 {
+		t.Fatal("unexpected buffer capacity")
+	}
+}
+
+func TestAvailable(t *testing.T) {
+	rb := ringbuffer.New(16)
+
+	_, _ = rb.Write([]byte("0123456789"))
+	if rb.Available() != 6 {
+		t.Fatal("unexpected available space")
+	}
+
+	_, _ = rb.Read(make([]byte, 4))
+	if rb.Available() != 10 {
+		t.Fatal("unexpected available space")
+	}
+}
+
+func TestDiscard(t *testing.T) {
+	rb := ringbuffer.New(16)
+
+	// Create a wrapped buffer.
+	_, _ = rb.Write(make([]byte, 12))
+	_, _ = rb.Read(make([]byte, 12))
+	_, _ = rb.Write([]byte("0123456789"))
+
+	// Discard across the wrap boundary.
+	n, err := rb.Discard(6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 6 {
+		t.Fatal("discarded data length mismatch")
+	}
+
+	b, _ := rb.ReadByte()
+	if b != '6' {
+		t.Fatal("invalid data read")
+	}
+
+	// Discard more than buffered.
+	n, err = rb.Discard(10)
+	if err != io.EOF {
+		t.Fatal("expected EOF")
+	}
+	if n != 3 {
+		t.Fatal("discarded data length mismatch")
+	}
+	trb := &testRingBuffer{
+		t:  t,
+		rb: rb,
+	}
+	trb.checkLen(0)
+}
+
+func TestTruncate(t *testing.T) {
+	rb := ringbuffer.New(16)
+
+	// Create a wrapped buffer.
+	_, _ = rb.Write(make([]byte, 12))
+	_, _ = rb.Read(make([]byte, 12))
+	_, _ = rb.Write([]byte("0123456789"))
+
+	rb.Truncate(6)
+
+	var scanned []byte
+	rb.Scan(func(elem byte, _ int) bool {
+		scanned = append(scanned, elem)
+		return false
+	})
+	if string(scanned) != "012345" {
+		t.Fatal("invalid data scanned")
+	}
+
+	// The space released by the truncation must be reused.
+	_, _ = rb.Write([]byte("ab"))
+	buf := make([]byte, 16)
+	n, _ := rb.Read(buf)
+	if string(buf[:n]) != "012345ab" {
+		t.Fatal("invalid data read")
+	}
+}
+
+func TestTruncateOutOfRange(t *testing.T) {
+	rb := ringbuffer.New(16)
+	_, _ = rb.Write(testData)
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic")
+		}
+	}()
+	rb.Truncate(6)
+}
+
+func TestBytes(t *testing.T) {
+	rb := ringbuffer.New(16)
+
+	// Create a wrapped buffer.
+	_, _ = rb.Write(make([]byte, 12))
+	_, _ = rb.Read(make([]byte, 12))
+	_, _ = rb.Write([]byte("0123456789"))
+
+	b := rb.Bytes()
+	if string(b) != "0123456789" {
+		t.Fatal("invalid data returned")
+	}
+
+	// Modifying the copy must not affect the buffer.
+	b[0] = 'x'
+	if string(rb.Bytes()) != "0123456789" {
+		t.Fatal("invalid data returned")
+	}
+	if rb.Len() != 10 {
+		t.Fatal("unexpected buffer length")
+	}
+}
+
+func TestString(t *testing.T) {
+	rb := ringbuffer.New(16)
+
+	// Create a wrapped buffer.
+	_, _ = rb.Write(make([]byte, 12))
+	_, _ = rb.Read(make([]byte, 12))
+	_, _ = rb.Write([]byte("0123456789"))
+
+	if fmt.Sprintf("%v", rb) != "0123456789" {
+		t.Fatal("invalid formatted data")
+	}
+	if rb.Len() != 10 {
+		t.Fatal("unexpected buffer length")
+	}
+}
+
+func TestBounded(t *testing.T) {
+	rb := ringbuffer.NewBounded(16)
+
+	// Fill the buffer using a partial write.
+	_, _ = rb.Write(make([]byte, 10))
+	n, err := rb.Write([]byte("0123456789"))
+	if err != io.ErrShortWrite {
+		t.Fatal("expected short write")
+	}
+	if n != 6 {
+		t.Fatal("written data length mismatch")
+	}
+	if rb.Len() != 16 || rb.Cap() != 16 {
+		t.Fatal("unexpected buffer length")
+	}
+
+	// The buffer is full.
+	n, err = rb.Write(testData)
+	if err != io.ErrShortWrite {
+		t.Fatal("expected short write")
+	}
+	if n != 0 {
+		t.Fatal("written data length mismatch")
+	}
+	if rb.WriteByte('a') != ringbuffer.ErrBufferOverflow {
+		t.Fatal("expected buffer overflow")
+	}
+
+	// Check data.
+	_, _ = rb.Discard(10)
+	if rb.String() != "012345" {
+		t.Fatal("invalid data read")
+	}
+}
+
+func TestSetMaxSize(t *testing.T) {
+	chunk := make([]byte, 65536)
+
+	// Raise the limit.
+	rb := ringbuffer.New(1048576)
+	rb.SetMaxSize(8 * 1048576)
+	for i := 0; i < 80; i++ {
+		if _, err := rb.Write(chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if rb.Len() != 80*len(chunk) {
+		t.Fatal("unexpected buffer length")
+	}
+
+	// Lower the limit.
+	rb = ringbuffer.New(16)
+	rb.SetMaxSize(40)
+	if _, err := rb.Write(chunk[:40]); err != nil {
+		t.Fatal(err)
+	}
+	if rb.Cap() != 40 {
+		t.Fatal("unexpected buffer capacity")
+	}
+	if _, err := rb.Write(testData); err != ringbuffer.ErrBufferOverflow {
+		t.Fatal("expected buffer overflow")
+	}
+}
+
+func TestLargeGrowSize(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), 65536)
+
+	// The grow size is capped but the buffer can grow beyond it.
+	rb := ringbuffer.New(2000000)
+	if rb.Cap() != 1048576 {
+		t.Fatal("unexpected buffer capacity")
+	}
+
+	rb = ringbuffer.New(1048576)
+	for i := 0; i < 5; i++ {
+		if _, err := rb.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if rb.Len() != 5*len(data) || rb.Cap() != 5*1048576 {
+		t.Fatal("unexpected buffer length")
+	}
+
+	buf := make([]byte, len(data))
+	for i := 0; i < 5; i++ {
+		n, err := rb.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != len(data) || !bytes.Equal(buf, data) {
+			t.Fatal("invalid data read")
+		}
+	}
+}
+
+func TestReadFull(t *testing.T) {
+	rb := ringbuffer.New(16)
+
+	go func() {
+		_, _ = rb.Write([]byte("01234"))
+		time.Sleep(50 * time.Millisecond)
+		_, _ = rb.Write([]byte("56789"))
+	}()
+
+	var buf [10]byte
+	n, err := rb.ReadFull(buf[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(buf) || string(buf[:]) != "0123456789" {
+		t.Fatal("invalid data read")
+	}
+	if rb.Len() != 0 {
+		t.Fatal("unexpected buffer length")
+	}
+
+	// The request can never be satisfied.
+	rb.SetMaxSize(32)
+	if _, err = rb.ReadFull(make([]byte, 64)); err != io.ErrShortBuffer {
+		t.Fatal("expected short buffer error")
+	}
+}
+
+func TestClose(t *testing.T) {
+	rb := ringbuffer.New(16)
+	_, _ = rb.Write([]byte("01234"))
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = rb.Close()
+	}()
+
+	// The blocked reader must be woken up.
+	var buf [10]byte
+	_, err := rb.ReadFull(buf[:])
+	if err != ringbuffer.ErrClosed {
+		t.Fatal("expected closed error")
+	}
+
+	// Buffered data can still be read.
+	if _, err = rb.Write(testData); err != ringbuffer.ErrClosed {
+		t.Fatal("expected closed error")
+	}
+	n, err := rb.Read(buf[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf[:n]) != "01234" {
+		t.Fatal("invalid data read")
+	}
+	if _, err = rb.Read(buf[:]); err != ringbuffer.ErrClosed {
+		t.Fatal("expected closed error")
+	}
+}
+
+func TestReadContext(t *testing.T) {
+	rb := ringbuffer.New(16)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_, _ = rb.Write(testData)
+	}()
+
+	// Wait for data.
+	var buf [10]byte
+	n, err := rb.ReadContext(context.Background(), buf[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf[:n], testData) {
+		t.Fatal("invalid data read")
+	}
+
+	// Cancel while waiting.
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+	start := time.Now()
+	_, err = rb.ReadContext(ctx, buf[:])
+	if err != context.Canceled {
+		t.Fatal("expected context canceled")
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("read did not return in time")
+	}
+}
+
+func TestPeekSegments(t *testing.T) {
+	rb := ringbuffer.New(16)
+
+	// Contiguous data.
+	_, _ = rb.Write(make([]byte, 12))
+	first, second := rb.PeekSegments()
+	if len(first) != 12 || second != nil {
+		t.Fatal("unexpected segments")
+	}
+
+	// Wrapped data.
+	_, _ = rb.Read(make([]byte, 12))
+	_, _ = rb.Write([]byte("0123456789"))
+	first, second = rb.PeekSegments()
+	if string(first)+string(second) != "0123456789" || second == nil {
+		t.Fatal("unexpected segments")
+	}
+	if rb.Len() != 10 {
+		t.Fatal("unexpected buffer length")
+	}
+}
+
+func TestCommitRead(t *testing.T) {
+	rb := ringbuffer.New(16)
+
+	// Create a wrapped buffer.
+	_, _ = rb.Write(make([]byte, 12))
+	_, _ = rb.Read(make([]byte, 12))
+	_, _ = rb.Write([]byte("0123456789"))
+
+	first, _ := rb.PeekSegments()
+	rb.CommitRead(len(first) + 2)
+
+	if rb.String() != "6789" {
+		t.Fatal("invalid data read")
+	}
+}
+
+func TestGetWriteSegments(t *testing.T) {
+	rb := ringbuffer.New(16)
+
+	// Move the read-position so the free space wraps.
+	_, _ = rb.Write(make([]byte, 12))
+	_, _ = rb.Read(make([]byte, 12))
+
+	first, second, err := rb.GetWriteSegments(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first) != 4 || len(second) != 12 {
+		t.Fatal("unexpected segments")
+	}
+
+	// Request more space than available.
+	_, _ = rb.Write(make([]byte, 10))
+	first, second, err = rb.GetWriteSegments(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first)+len(second) < 10 || rb.Cap() != 32 {
+		t.Fatal("unexpected segments")
+	}
+}
+
+func TestCommitWrite(t *testing.T) {
+	rb := ringbuffer.New(16)
+
+	// Move the read-position so the free space wraps.
+	_, _ = rb.Write(make([]byte, 12))
+	_, _ = rb.Read(make([]byte, 12))
+
+	first, second, _ := rb.GetWriteSegments(10)
+	copy(first, "0123")
+	copy(second, "456789abcdef")
+
+	// Commit fewer bytes than available.
+	err := rb.CommitWrite(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rb.String() != "0123456" {
+		t.Fatal("invalid data read")
+	}
+
+	// Commit more bytes than available.
+	if rb.CommitWrite(10) == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestFindLast(t *testing.T) {
+	rb := ringbuffer.New(16)
+
+	// Create a wrapped buffer.
+	_, _ = rb.Write(make([]byte, 12))
+	_, _ = rb.Read(make([]byte, 12))
+	_, _ = rb.Write([]byte("a,b,c,d,e"))
+
+	if rb.FindLast(',') != 7 {
+		t.Fatal("unexpected index")
+	}
+	if rb.FindLast('a') != 0 {
+		t.Fatal("unexpected index")
+	}
+	if rb.FindLast('z') != -1 {
+		t.Fatal("unexpected index")
+	}
+}
+
+func TestCount(t *testing.T) {
+	rb := ringbuffer.New(16)
+
+	// Create a wrapped buffer.
+	_, _ = rb.Write(make([]byte, 12))
+	_, _ = rb.Read(make([]byte, 12))
+	_, _ = rb.Write([]byte("a\nb\n\nc\nd\n"))
+
+	if rb.Count('\n') != bytes.Count(rb.Bytes(), []byte{'\n'}) {
+		t.Fatal("unexpected count")
+	}
+	if rb.Count('z') != 0 {
+		t.Fatal("unexpected count")
+	}
+}
+
+func TestReadLine(t *testing.T) {
+	rb := ringbuffer.New(16)
+
+	// Create a wrapped buffer.
+	_, _ = rb.Write(make([]byte, 12))
+	_, _ = rb.Read(make([]byte, 12))
+	_, _ = rb.Write([]byte("line1\nline"))
+
+	line, err := rb.ReadLine()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(line) != "line1\n" {
+		t.Fatal("invalid line read")
+	}
+
+	// Incomplete line.
+	_, err = rb.ReadLine()
+	if err != io.EOF {
+		t.Fatal("expected EOF")
+	}
+	if rb.String() != "line" {
+		t.Fatal("unexpected buffer contents")
+	}
+}
+
+func TestReadUntil(t *testing.T) {
+	rb := ringbuffer.New(16)
+
+	// Create a wrapped buffer.
+	_, _ = rb.Write(make([]byte, 12))
+	_, _ = rb.Read(make([]byte, 12))
+	_, _ = rb.Write([]byte(";abc;defgh"))
+
+	// Delimiter at the start.
+	data, err := rb.ReadUntil(';')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != ";" {
+		t.Fatal("invalid data read")
+	}
+
+	// Delimiter at the wrap boundary.
+	data, err = rb.ReadUntil(';')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "abc;" {
+		t.Fatal("invalid data read")
+	}
+
+	// Missing delimiter.
+	_, err = rb.ReadUntil(';')
+	if err != ringbuffer.ErrDelimiterNotFound {
+		t.Fatal("expected delimiter not found")
+	}
+	if rb.String() != "defgh" {
+		t.Fatal("unexpected buffer contents")
+	}
+}
+
+func TestReadUntilBytes(t *testing.T) {
+	rb := ringbuffer.New(16)
+
+	// Create a wrapped buffer with a delimiter that straddles the boundary.
+	_, _ = rb.Write(make([]byte, 12))
+	_, _ = rb.Read(make([]byte, 12))
+	_, _ = rb.Write([]byte("ab\r\r\nc\r"))
+
+	data, err := rb.ReadUntilBytes([]byte("\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "ab\r\r\n" {
+		t.Fatal("invalid data read")
+	}
+
+	// Missing delimiter.
+	_, err = rb.ReadUntilBytes([]byte("\r\n"))
+	if err != ringbuffer.ErrDelimiterNotFound {
+		t.Fatal("expected delimiter not found")
+	}
+	if rb.String() != "c\r" {
+		t.Fatal("unexpected buffer contents")
+	}
+
+	// Empty delimiter.
+	_, err = rb.ReadUntilBytes(nil)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestReplaceByte(t *testing.T) {
+	rb := newWrappedRingBuffer("a-b-c-d-e")
+
+	if rb.ReplaceByte('-', '+') != 4 {
+		t.Fatal("unexpected replace count")
+	}
+	if rb.String() != "a+b+c+d+e" {
+		t.Fatal("invalid data read")
+	}
+}
+
+func TestClone(t *testing.T) {
+	rb := newWrappedRingBuffer("0123456789")
+	c := rb.Clone()
+
+	_, _ = rb.Write([]byte("ab"))
+	_, _ = c.Discard(2)
+	_, _ = c.Write([]byte("cd"))
+
+	if rb.String() != "0123456789ab" {
+		t.Fatal("unexpected original contents")
+	}
+	if c.String() != "23456789cd" {
+		t.Fatal("unexpected clone contents")
+	}
+
+	// Settings are copied.
+	rb.SetZeroOnRead(true)
+	writes := 0
+	rb.SetHooks(nil, func(n int) {
+		writes += n
+	})
+	c = rb.Clone()
+	_, _ = c.Write([]byte("xyz"))
+	if writes != 3 {
+		t.Fatal("hooks not copied")
+	}
+	_ = c.ReadAll()
+	if !bytes.Equal(c.BackingArray(), make([]byte, c.Cap())) {
+		t.Fatal("zero-on-read not copied")
+	}
+}
+
+func TestEqual(t *testing.T) {
+	rb1 := ringbuffer.New(16)
+	_, _ = rb1.Write([]byte("0123456789"))
+	rb2 := newWrappedRingBuffer("0123456789")
+
+	if !rb1.Equal(rb2) || !rb2.Equal(rb1) {
+		t.Fatal("buffers must be equal")
+	}
+
+	_, _ = rb2.Write([]byte("a"))
+	if rb1.Equal(rb2) {
+		t.Fatal("buffers must differ")
+	}
+	_, _ = rb1.Write([]byte("b"))
+	if rb1.Equal(rb2) {
+		t.Fatal("buffers must differ")
+	}
+}
+
+func TestCopyTo(t *testing.T) {
+	rb := newWrappedRingBuffer("0123456789")
+
+	// Partial copy.
+	var buf [6]byte
+	if rb.CopyTo(buf[:]) != 6 || string(buf[:]) != "012345" {
+		t.Fatal("invalid data copied")
+	}
+
+	// Copy everything, the remaining of the destination must not be touched.
+	big := bytes.Repeat([]byte{'x'}, 12)
+	if rb.CopyTo(big) != 10 || string(big) != "0123456789xx" {
+		t.Fatal("invalid data copied")
+	}
+
+	// Contiguous data.
+	rb = ringbuffer.New(16)
+	_, _ = rb.Write(testData)
+	big = bytes.Repeat([]byte{'x'}, 8)
+	if rb.CopyTo(big) != 5 || string(big) != "Helloxxx" {
+		t.Fatal("invalid data copied")
+	}
+
+	// Empty buffer.
+	rb.Reset()
+	if rb.CopyTo(buf[:]) != 0 {
+		t.Fatal("invalid data copied")
+	}
+}
+
+func TestPeekAt(t *testing.T) {
+	rb := newWrappedRingBuffer("0123456789")
+
+	// Offset in the first segment spanning the wrap boundary.
+	var buf [4]byte
+	n, err := rb.PeekAt(2, buf[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf[:n]) != "2345" {
+		t.Fatal("invalid data read")
+	}
+
+	// Offset in the second segment.
+	n, err = rb.PeekAt(7, buf[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf[:n]) != "789" {
+		t.Fatal("invalid data read")
+	}
+
+	// Offset past the end.
+	_, err = rb.PeekAt(10, buf[:])
+	if err != io.EOF {
+		t.Fatal("expected EOF")
+	}
+	if rb.Len() != 10 {
+		t.Fatal("unexpected buffer length")
+	}
+}
+
+func TestReadBoundaries(t *testing.T) {
+	rb := ringbuffer.New(16)
+
+	// Read a full-capacity buffer in one call, twice.
+	data := []byte("0123456789abcdef")
+	buf := make([]byte, 16)
+	for i := 0; i < 2; i++ {
+		_, _ = rb.Write(data)
+		n, err := rb.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 16 || !bytes.Equal(buf, data) {
+			t.Fatal("invalid data read")
+		}
+		if rb.Cap() != 16 {
+			t.Fatal("unexpected buffer capacity")
+		}
+	}
+
+	// Consume exactly the contiguous tail of a wrapped buffer.
+	rb = newWrappedRingBuffer("0123456789")
+	n, _ := rb.Read(buf[:4])
+	if n != 4 || string(buf[:4]) != "0123" {
+		t.Fatal("invalid data read")
+	}
+	first, second := rb.PeekSegments()
+	if string(first) != "456789" || second != nil {
+		t.Fatal("unexpected segments")
+	}
+
+	// Fill the buffer completely and read it back.
+	_, _ = rb.Write([]byte("abcdefghij"))
+	n, _ = rb.Read(buf)
+	if n != 16 || string(buf) != "456789abcdefghij" {
+		t.Fatal("invalid data read")
+	}
+	if rb.Cap() != 16 {
+		t.Fatal("unexpected buffer capacity")
+	}
+}
+
+func TestGrow(t *testing.T) {
+	rb := ringbuffer.New(16)
+	_, _ = rb.Write(testData)
+
+	err := rb.Grow(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rb.Available() < 1000 {
+		t.Fatal("unexpected available space")
+	}
+
+	// Writes that fit must not grow the buffer.
+	capacity := rb.Cap()
+	_, _ = rb.Write(make([]byte, 1000))
+	if rb.Cap() != capacity {
+		t.Fatal("unexpected buffer capacity")
+	}
+
+	// Growth beyond the max size.
+	rb.SetMaxSize(2048)
+	if rb.Grow(2048) != ringbuffer.ErrBufferOverflow {
+		t.Fatal("expected buffer overflow")
+	}
+}
+
+func TestShrink(t *testing.T) {
+	rb := ringbuffer.New(16)
+
+	// Grow the buffer and drain most of it leaving the data wrapped.
+	_, _ = rb.Write(make([]byte, 1020))
+	_, _ = rb.Read(make([]byte, 1010))
+	_, _ = rb.Write([]byte("0123456789"))
+	if rb.Cap() != 1024 {
+		t.Fatal("unexpected buffer capacity")
+	}
+	expected := rb.Bytes()
+
+	rb.Shrink()
+	if rb.Cap() != 32 {
+		t.Fatal("unexpected buffer capacity")
+	}
+	if !bytes.Equal(rb.Bytes(), expected) {
+		t.Fatal("unexpected buffer contents")
+	}
+
+	// Writes after shrinking must keep working.
+	_, _ = rb.Write(testData)
+	if rb.String() != string(expected)+"Hello" {
+		t.Fatal("unexpected buffer contents")
+	}
+}
+
+func TestGrowStep(t *testing.T) {
+	rb := ringbuffer.NewWithGrowStep(24000, 1000)
+	if rb.Cap() != 24000 {
+		t.Fatal("unexpected buffer capacity")
+	}
+
+	_, _ = rb.Write(make([]byte, 24001))
+	if rb.Cap() != 25000 {
+		t.Fatal("unexpected buffer capacity")
+	}
+	_, _ = rb.Write(make([]byte, 1000))
+	if rb.Cap() != 26000 {
+		t.Fatal("unexpected buffer capacity")
+	}
+	_, _ = rb.Write(make([]byte, 2500))
+	if rb.Cap() != 28000 {
+		t.Fatal("unexpected buffer capacity")
+	}
+}
+
+func TestStats(t *testing.T) {
+	rb := ringbuffer.New(16)
+
+	_, _ = rb.Write(make([]byte, 10))
+	_, _ = rb.Read(make([]byte, 4))
+	_, _ = rb.Write(make([]byte, 20))
+	_, _ = rb.Discard(6)
+	_ = rb.WriteByte('a')
+	_, _ = rb.Write(make([]byte, 40))
+	rb.Reset()
+
+	totalWritten, totalRead, grows := rb.Stats()
+	if totalWritten != 71 || totalRead != 10 || grows != 2 {
+		t.Fatal("unexpected statistics")
+	}
+}
+
+func TestIsEmptyIsFull(t *testing.T) {
+	rb := ringbuffer.New(16)
+	if !rb.IsEmpty() || rb.IsFull() {
+		t.Fatal("buffer must be empty")
+	}
+
+	_, _ = rb.Write(testData)
+	if rb.IsEmpty() || rb.IsFull() {
+		t.Fatal("buffer must be partially filled")
+	}
+
+	_, _ = rb.Write(make([]byte, 11))
+	if rb.IsEmpty() || !rb.IsFull() {
+		t.Fatal("buffer must be full")
+	}
+
+	// Wrapped data.
+	rb = newWrappedRingBuffer("0123456789")
+	if rb.IsEmpty() || rb.IsFull() {
+		t.Fatal("buffer must be partially filled")
+	}
+	_, _ = rb.Write(make([]byte, 6))
+	if rb.IsEmpty() || !rb.IsFull() {
+		t.Fatal("buffer must be full")
+	}
+	_, _ = rb.Discard(16)
+	if !rb.IsEmpty() || rb.IsFull() {
+		t.Fatal("buffer must be empty")
+	}
+}
+
+func TestReadAll(t *testing.T) {
+	rb := newWrappedRingBuffer("0123456789")
+
+	if string(rb.ReadAll()) != "0123456789" {
+		t.Fatal("invalid data read")
+	}
+	if rb.Len() != 0 {
+		t.Fatal("unexpected buffer length")
+	}
+	if _, err := rb.Read(make([]byte, 4)); err != io.EOF {
+		t.Fatal("expected EOF")
+	}
+}
+
+func TestEOFOnDrain(t *testing.T) {
+	var buf [8]byte
+
+	// Default behavior.
+	rb := newWrappedRingBuffer("0123456789")
+	n, err := rb.Read(buf[:])
+	if n != 8 || err != nil {
+		t.Fatal("unexpected read result")
+	}
+	n, err = rb.Read(buf[:])
+	if n != 2 || err != nil {
+		t.Fatal("unexpected read result")
+	}
+	n, err = rb.Read(buf[:])
+	if n != 0 || err != io.EOF {
+		t.Fatal("unexpected read result")
+	}
+
+	// EOF along with the last bytes.
+	rb = newWrappedRingBuffer("0123456789")
+	rb.SetEOFOnDrain(true)
+	n, err = rb.Read(buf[:])
+	if n != 8 || err != nil {
+		t.Fatal("unexpected read result")
+	}
+	n, err = rb.Read(buf[:])
+	if n != 2 || err != io.EOF {
+		t.Fatal("unexpected read result")
+	}
+	if string(buf[:2]) != "89" {
+		t.Fatal("invalid data read")
+	}
+}
+
+func TestMarshalBinary(t *testing.T) {
+	for _, rb := range []*ringbuffer.RingBuffer{newWrappedRingBuffer("0123456789"), ringbuffer.New(64)} {
+		data, err := rb.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		restored := &ringbuffer.RingBuffer{}
+		err = restored.UnmarshalBinary(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !restored.Equal(rb) || restored.Cap() != rb.Cap() {
+			t.Fatal("unexpected restored buffer")
+		}
+
+		// The restored buffer must be fully functional.
+		_, _ = restored.Write(make([]byte, 100))
+		if restored.Len() != rb.Len()+100 {
+			t.Fatal("unexpected buffer length")
+		}
+	}
+
+	// Invalid data.
+	if (&ringbuffer.RingBuffer{}).UnmarshalBinary([]byte("bad")) == nil {
+		t.Fatal("expected error")
+	}
+	data := make([]byte, 16)
+	data[7] = 8 // Grow size below the minimum.
+	if (&ringbuffer.RingBuffer{}).UnmarshalBinary(data) == nil {
+		t.Fatal("expected error")
+	}
+
+	// The receiver limits are honored.
+	data, _ = ringbuffer.NewFromBytes(make([]byte, 40), 16).MarshalBinary()
+	bounded := ringbuffer.NewBounded(32)
+	if bounded.UnmarshalBinary(data) != ringbuffer.ErrBufferOverflow {
+		t.Fatal("expected buffer overflow")
+	}
+	limited := ringbuffer.New(16)
+	limited.SetMaxSize(32)
+	if limited.UnmarshalBinary(data) != ringbuffer.ErrBufferOverflow {
+		t.Fatal("expected buffer overflow")
+	}
+	data, _ = ringbuffer.NewFromBytes(make([]byte, 20), 64).MarshalBinary()
+	err := bounded.UnmarshalBinary(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bounded.Cap() != 32 || bounded.Len() != 20 {
+		t.Fatal("unexpected restored buffer")
+	}
+}
+
+func TestGob(t *testing.T) {
+	rb := newWrappedRingBuffer("0123456789")
+
+	var network bytes.Buffer
+	err := gob.NewEncoder(&network).Encode(rb)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restored := &ringbuffer.RingBuffer{}
+	err = gob.NewDecoder(&network).Decode(restored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(restored.Bytes(), rb.Bytes()) || restored.Cap() != rb.Cap() {
+		t.Fatal("unexpected restored buffer")
+	}
+}
+
+func TestSkipWhile(t *testing.T) {
+	isSpace := func(b byte) bool {
+		return b == ' '
+	}
+
+	// Skip a run that crosses the wrap boundary.
+	rb := newWrappedRingBuffer("      abc")
+	if rb.SkipWhile(isSpace) != 6 {
+		t.Fatal("unexpected skipped count")
+	}
+	if rb.String() != "abc" {
+		t.Fatal("unexpected buffer contents")
+	}
+
+	// Skip all the buffered data.
+	rb = newWrappedRingBuffer("          ")
+	if rb.SkipWhile(isSpace) != 10 {
+		t.Fatal("unexpected skipped count")
+	}
+	if rb.Len() != 0 {
+		t.Fatal("unexpected buffer length")
+	}
+}
+
+func TestWriteString(t *testing.T) {
+	rb := newWrappedRingBuffer("")
+
+	n, err := rb.WriteString("0123456789")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 10 {
+		t.Fatal("written data length mismatch")
+	}
+	first, second := rb.PeekSegments()
+	if second == nil {
+		t.Fatal("expected wrapped data")
+	}
+	if !bytes.Equal(append(first, second...), []byte("0123456789")) {
+		t.Fatal("invalid data read")
+	}
+}
+
+func TestOverwriteAt(t *testing.T) {
+	rb := newWrappedRingBuffer("0123456789")
+
+	// Overwrite a region that crosses the wrap boundary.
+	n, err := rb.OverwriteAt(2, []byte("abcd"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 4 || rb.String() != "01abcd6789" {
+		t.Fatal("unexpected buffer contents")
+	}
+
+	// Overwrite the tail.
+	_, err = rb.OverwriteAt(8, []byte("xy"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rb.String() != "01abcd67xy" {
+		t.Fatal("unexpected buffer contents")
+	}
+
+	// Out of range.
+	_, err = rb.OverwriteAt(8, []byte("xyz"))
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if rb.Len() != 10 {
+		t.Fatal("unexpected buffer length")
+	}
+}
+
+func TestFindFrom(t *testing.T) {
+	rb := newWrappedRingBuffer("a,b,c,d,e")
+
+	if rb.FindFrom(',', 0) != 1 {
+		t.Fatal("unexpected index")
+	}
+	// Match before the start must be ignored.
+	if rb.FindFrom(',', 2) != 3 {
+		t.Fatal("unexpected index")
+	}
+	// Match after the wrap.
+	if rb.FindFrom(',', 4) != 5 {
+		t.Fatal("unexpected index")
+	}
+	if rb.FindFrom('a', 1) != -1 {
+		t.Fatal("unexpected index")
+	}
+	if rb.FindFrom(',', 100) != -1 {
+		t.Fatal("unexpected index")
+	}
+}
+
+func TestReadRune(t *testing.T) {
+	// Multi-byte runes straddling the wrap boundary at different positions.
+	for _, prefix := range []string{"", "a", "ab", "abc"} {
+		rb := newWrappedRingBuffer(prefix + "€𝄞" + "\xff")
+
+		for _, expected := range []rune(prefix + "€𝄞") {
+			ch, size, err := rb.ReadRune()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ch != expected || size != utf8.RuneLen(expected) {
+				t.Fatal("invalid rune read")
+			}
+		}
+
+		// Invalid sequence.
+		ch, size, err := rb.ReadRune()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ch != utf8.RuneError || size != 1 {
+			t.Fatal("expected rune error")
+		}
+
+		_, _, err = rb.ReadRune()
+		if err != io.EOF {
+			t.Fatal("expected EOF")
+		}
+	}
+}
+
+func TestNewReader(t *testing.T) {
+	rb := newWrappedRingBuffer("0123456789")
+	rd := rb.NewReader()
+
+	// Further writes must not affect the snapshot.
+	_, _ = rb.Write(testData)
+
+	var buf [4]byte
+	_, _ = rd.Seek(6, io.SeekStart)
+	n, _ := rd.Read(buf[:])
+	if string(buf[:n]) != "6789" {
+		t.Fatal("invalid data read")
+	}
+	_, _ = rd.Seek(-8, io.SeekCurrent)
+	n, _ = rd.Read(buf[:])
+	if string(buf[:n]) != "2345" {
+		t.Fatal("invalid data read")
+	}
+	if _, err := rd.Seek(4, io.SeekCurrent); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rd.Read(buf[:]); err != io.EOF {
+		t.Fatal("expected EOF")
+	}
+
+	if rb.String() != "0123456789Hello" {
+		t.Fatal("unexpected buffer contents")
+	}
+}
+
+func TestTryReadWrite(t *testing.T) {
+	rb := ringbuffer.New(16)
+	_, _ = rb.Write(testData)
+
+	// Keep the buffer busy from another goroutine.
+	scanning := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		rb.Scan(func(_ byte, idx int) bool {
+			if idx == 0 {
+				close(scanning)
+				<-release
+			}
+			return true
+		})
+		close(done)
+	}()
+	<-scanning
+
+	var buf [5]byte
+	if _, ok := rb.TryRead(buf[:]); ok {
+		t.Fatal("expected busy buffer")
+	}
+	if _, ok := rb.TryWrite(testData); ok {
+		t.Fatal("expected busy buffer")
+	}
+
+	close(release)
+	<-done
+
+	n, ok := rb.TryWrite(testData)
+	if !ok || n != len(testData) {
+		t.Fatal("unexpected write result")
+	}
+	n, ok = rb.TryRead(buf[:])
+	if !ok || n != len(buf) || !bytes.Equal(buf[:], testData) {
+		t.Fatal("unexpected read result")
+	}
+}
+
+func TestConcurrentReaders(t *testing.T) {
+	rb := newWrappedRingBuffer("0123456789")
+
+	done := make(chan struct{})
+	for i := 0; i < 8; i++ {
+		go func() {
+			var buf [10]byte
+
+			for j := 0; j < 1000; j++ {
+				_ = rb.Len()
+				_, _ = rb.Peek(buf[:])
+				_ = rb.Find('5')
+			}
+			done <- struct{}{}
+		}()
+	}
+	for j := 0; j < 1000; j++ {
+		_, _ = rb.Write(testData)
+		_, _ = rb.Read(make([]byte, 5))
+	}
+	for i := 0; i < 8; i++ {
+		<-done
+	}
+
+	if rb.String() != "HelloHello" {
+		t.Fatal("unexpected buffer contents")
+	}
+}
+
+func TestWriteMulti(t *testing.T) {
+	rb := newWrappedRingBuffer("")
+
+	n, err := rb.WriteMulti([]byte("012"), nil, []byte("3456"), []byte("789"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 10 || rb.String() != "0123456789" {
+		t.Fatal("unexpected buffer contents")
+	}
+
+	// Partial write on bounded buffers.
+	rb = ringbuffer.NewBounded(16)
+	_, _ = rb.Write(make([]byte, 10))
+	n, err = rb.WriteMulti([]byte("0123"), []byte("4567"))
+	if err != io.ErrShortWrite {
+		t.Fatal("expected short write")
+	}
+	_, _ = rb.Discard(10)
+	if n != 6 || rb.String() != "012345" {
+		t.Fatal("unexpected buffer contents")
+	}
+}
+
+func TestStream(t *testing.T) {
+	rb := ringbuffer.New(16)
+	ch := rb.Stream(context.Background(), 3)
+
+	go func() {
+		for i := 0; i < 10; i++ {
+			_, _ = rb.Write(testData)
+		}
+		_ = rb.Close()
+	}()
+
+	var output []byte
+	for chunk := range ch {
+		if len(chunk) > 3 {
+			t.Fatal("unexpected chunk size")
+		}
+		output = append(output, chunk...)
+	}
+	if !bytes.Equal(output, bytes.Repeat(testData, 10)) {
+		t.Fatal("invalid data streamed")
+	}
+
+	// Cancel the context.
+	ctx, cancel := context.WithCancel(context.Background())
+	ch = ringbuffer.New(16).Stream(ctx, 3)
+	cancel()
+	if _, ok := <-ch; ok {
+		t.Fatal("expected closed channel")
+	}
+}
+
+func TestInvalidSizes(t *testing.T) {
+	for _, size := range []int{0, -5} {
+		rb := ringbuffer.New(size)
+		if rb.Cap() != 16 {
+			t.Fatal("unexpected buffer capacity")
+		}
+	}
+
+	rb := ringbuffer.New(16)
+	_, _ = rb.Write(testData)
+	if rb.Grow(math.MaxInt-1) != ringbuffer.ErrBufferOverflow {
+		t.Fatal("expected buffer overflow")
+	}
+	if rb.Grow(math.MaxInt) != ringbuffer.ErrBufferOverflow {
+		t.Fatal("expected buffer overflow")
+	}
+	if _, _, err := rb.GetWriteSegments(math.MaxInt - 2); err != ringbuffer.ErrBufferOverflow {
+		t.Fatal("expected buffer overflow")
+	}
+	if rb.Cap() != 16 || rb.String() != "Hello" {
+		t.Fatal("unexpected buffer state")
+	}
+}
+
+func TestOverflowCeiling(t *testing.T) {
+	rb := ringbuffer.New(16)
+	_, _ = rb.Write(testData)
+
+	// The required capacity does not fit in an int.
+	if rb.Grow(math.MaxInt-4) != ringbuffer.ErrBufferOverflow {
+		t.Fatal("expected buffer overflow")
+	}
+
+	// Beyond a configured ceiling.
+	rb.SetMaxSize(64)
+	n, err := rb.Write(make([]byte, 60))
+	if err != ringbuffer.ErrBufferOverflow {
+		t.Fatal("expected buffer overflow")
+	}
+	if n != 0 || rb.Cap() != 16 || rb.String() != "Hello" {
+		t.Fatal("unexpected buffer state")
+	}
+}
+
+func TestFill(t *testing.T) {
+	rb := newWrappedRingBuffer("ab")
+
+	// Fill across the wrap boundary.
+	n, err := rb.Fill('x', 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 8 || rb.String() != "abxxxxxxxx" {
+		t.Fatal("unexpected buffer contents")
+	}
+
+	// Fill forcing a grow.
+	n, err = rb.Fill('y', 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 20 || rb.String() != "abxxxxxxxx"+strings.Repeat("y", 20) {
+		t.Fatal("unexpected buffer contents")
+	}
+}
+
+func TestCompact(t *testing.T) {
+	rb := newWrappedRingBuffer("0123456789")
+
+	rb.Compact()
+	first, second := rb.PeekSegments()
+	if string(first) != "0123456789" || second != nil {
+		t.Fatal("unexpected segments")
+	}
+
+	// Contiguous data not located at the start.
+	_, _ = rb.Discard(3)
+	rb.Compact()
+	_, _ = rb.Write([]byte("abcdefghi"))
+	first, second = rb.PeekSegments()
+	if string(first) != "3456789abcdefghi" || second != nil {
+		t.Fatal("unexpected segments")
+	}
+}
+
+func TestWriteFull(t *testing.T) {
+	rb := ringbuffer.NewBounded(16)
+	_, _ = rb.Write(make([]byte, 12))
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_, _ = rb.Discard(12)
+	}()
+
+	n, err := rb.WriteFull([]byte("0123456789"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 10 || rb.String() != "0123456789" {
+		t.Fatal("unexpected buffer contents")
+	}
+
+	// Close while waiting.
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = rb.Close()
+	}()
+	n, err = rb.WriteFull([]byte("abcdefghij"))
+	if err != ringbuffer.ErrClosed {
+		t.Fatal("expected closed error")
+	}
+	if n != 6 {
+		t.Fatal("written data length mismatch")
+	}
+}
+
+func TestSetReadDeadline(t *testing.T) {
+	rb := ringbuffer.New(16)
+
+	var buf [4]byte
+	rb.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	start := time.Now()
+	_, err := rb.ReadFull(buf[:])
+	if err != os.ErrDeadlineExceeded {
+		t.Fatal("expected deadline exceeded")
+	}
+	_, err = rb.ReadContext(context.Background(), buf[:])
+	if err != os.ErrDeadlineExceeded {
+		t.Fatal("expected deadline exceeded")
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("read did not return in time")
+	}
+
+	// Clear the deadline.
+	rb.SetReadDeadline(time.Time{})
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_, _ = rb.Write(testData)
+	}()
+	n, err := rb.ReadFull(buf[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 4 || string(buf[:]) != "Hell" {
+		t.Fatal("invalid data read")
+	}
+}
+
+func TestScanReverse(t *testing.T) {
+	rb := newWrappedRingBuffer("0123456789")
+
+	var visited []byte
+	lastIdx := rb.Len()
+	rb.ScanReverse(func(elem byte, idx int) bool {
+		if idx != lastIdx-1 {
+			t.Fatal("unexpected index")
+		}
+		lastIdx = idx
+		visited = append(visited, elem)
+		return false
+	})
+
+	expected := rb.Bytes()
+	for i, j := 0, len(expected)-1; i < j; i, j = i+1, j-1 {
+		expected[i], expected[j] = expected[j], expected[i]
+	}
+	if !bytes.Equal(visited, expected) {
+		t.Fatal("unexpected visited sequence")
+	}
+
+	// Stop the iteration.
+	count := 0
+	rb.ScanReverse(func(_ byte, _ int) bool {
+		count += 1
+		return count == 7
+	})
+	if count != 7 {
+		t.Fatal("unexpected visited count")
+	}
+}
+
+func TestFindAny(t *testing.T) {
+	rb := newWrappedRingBuffer("abcd e;f,g")
+
+	idx, which := rb.FindAny([]byte(",; "))
+	if idx != 4 || which != ' ' {
+		t.Fatal("unexpected match")
+	}
+	idx, which = rb.FindAny([]byte(",;"))
+	if idx != 6 || which != ';' {
+		t.Fatal("unexpected match")
+	}
+	idx, which = rb.FindAny([]byte("xyz"))
+	if idx != -1 || which != 0 {
+		t.Fatal("unexpected match")
+	}
+}
+
+func TestHexDump(t *testing.T) {
+	rb := newWrappedRingBuffer("012345678\n")
+
+	expected := "00000000  30 31 32 33 34 35 36 37  38 0a                    |012345678.|\n"
+	if rb.HexDump() != expected {
+		t.Fatal("unexpected hex dump")
+	}
+	if rb.Len() != 10 {
+		t.Fatal("unexpected buffer length")
+	}
+}
+
+func TestNewWithCapacity(t *testing.T) {
+	rb := ringbuffer.NewWithCapacity(1000, 16)
+	if rb.Cap() != 1000 {
+		t.Fatal("unexpected initial capacity")
+	}
+
+	_, _ = rb.Write(make([]byte, 1000))
+	if rb.Cap() != 1000 {
+		t.Fatal("unexpected capacity")
+	}
+	_, _ = rb.Write(make([]byte, 1))
+	if rb.Cap() != 1016 {
+		t.Fatal("unexpected capacity after grow")
+	}
+	_, _ = rb.Write(make([]byte, 20))
+	if rb.Cap() != 1032 {
+		t.Fatal("unexpected capacity after second grow")
+	}
+
+	rb = ringbuffer.NewWithCapacity(0, 20)
+	if rb.Cap() != 32 {
+		t.Fatal("unexpected default initial capacity")
+	}
+}
+
+func TestWriteFreeSegments(t *testing.T) {
+	buf := make([]byte, 16)
+
+	// Free space split between the tail and the prefix.
+	rb := ringbuffer.NewBounded(16)
+	_, _ = rb.Write([]byte("0123456789"))
+	_, _ = rb.Read(buf[:6])
+	n, err := rb.Write([]byte("abcdefghijkl"))
+	if err != nil || n != 12 {
+		t.Fatal("unexpected write result")
+	}
+	n, _ = rb.Read(buf)
+	if string(buf[:n]) != "6789abcdefghijkl" {
+		t.Fatal("invalid data read")
+	}
+
+	// Unread data already wraps, so the free space is the gap before the read-position.
+	rb = ringbuffer.NewBounded(16)
+	_, _ = rb.Write([]byte("0123456789abcd"))
+	_, _ = rb.Read(buf[:10])
+	_, _ = rb.Write([]byte("efghijkl"))
+	n, err = rb.Write([]byte("mnopq"))
+	if err != io.ErrShortWrite || n != 4 {
+		t.Fatal("expected short write")
+	}
+	n, _ = rb.Read(buf)
+	if string(buf[:n]) != "abcdefghijklmnop" {
+		t.Fatal("invalid data read")
+	}
+
+	// Unread data ends exactly at the end of the array.
+	rb = ringbuffer.NewBounded(16)
+	_, _ = rb.Write([]byte("0123456789abcdef"))
+	_, _ = rb.Read(buf[:10])
+	n, err = rb.Write([]byte("ghijklmnop"))
+	if err != nil || n != 10 {
+		t.Fatal("unexpected write result")
+	}
+	n, _ = rb.Read(buf)
+	if string(buf[:n]) != "abcdefghijklmnop" {
+		t.Fatal("invalid data read")
+	}
+}
+
+func TestReadN(t *testing.T) {
+	rb := newWrappedRingBuffer("0123456789")
+
+	b, err := rb.ReadN(11)
+	if err != ringbuffer.ErrShortRead || b != nil {
+		t.Fatal("expected short read")
+	}
+	if rb.Len() != 10 {
+		t.Fatal("unexpected buffer length")
+	}
+
+	b, err = rb.ReadN(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "0123456789" {
+		t.Fatal("invalid data read")
+	}
+	if rb.Len() != 0 {
+		t.Fatal("unexpected buffer length")
+	}
+}
+
+func TestPipe(t *testing.T) {
+	src := newWrappedRingBuffer("0123456789")
+	dst := newWrappedRingBuffer("ab")
+
+	n, err := dst.Pipe(src, 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 6 {
+		t.Fatal("unexpected moved bytes count")
+	}
+	if src.String() != "6789" || dst.String() != "ab012345" {
+		t.Fatal("invalid buffer contents")
+	}
+
+	// Source runs dry.
+	n, err = dst.Pipe(src, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 4 {
+		t.Fatal("unexpected moved bytes count")
+	}
+	if src.Len() != 0 || dst.String() != "ab0123456789" {
+		t.Fatal("invalid buffer contents")
+	}
+
+	_, err = dst.Pipe(src, 1)
+	if err != io.EOF {
+		t.Fatal("expected EOF")
+	}
+}
+
+func TestAutoShrink(t *testing.T) {
+	rb := ringbuffer.New(16)
+	_, _ = rb.Write(make([]byte, 1024))
+	rb.SetAutoShrink(true, 3)
+
+	// A read leaving the buffer busy restarts the count.
+	_, _ = rb.Read(make([]byte, 24))
+	_, _ = rb.Read(make([]byte, 1000))
+	if rb.Cap() != 1024 {
+		t.Fatal("unexpected capacity")
+	}
+
+	// The second and third idle reads do not shrink the buffer yet.
+	buf := make([]byte, 8)
+	for i := 0; i < 2; i++ {
+		_, _ = rb.Write(buf)
+		_, _ = rb.Read(buf)
+		if rb.Cap() != 1024 {
+			t.Fatal("buffer shrunk too early")
+		}
+	}
+
+	// Reads that consume nothing are not counted.
+	_, _ = rb.Read(buf)
+	if rb.Cap() != 1024 {
+		t.Fatal("buffer shrunk by an empty read")
+	}
+
+	// The fourth idle read shrinks it.
+	_, _ = rb.Write(buf)
+	_, _ = rb.Read(buf)
+	if rb.Cap() != 16 {
+		t.Fatal("buffer not shrunk")
+	}
+}
+
+func TestWriteReader(t *testing.T) {
+	rb := newWrappedRingBuffer("")
+
+	n, err := rb.WriteReader(iotest.HalfReader(strings.NewReader("0123456789abcdef")), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 10 {
+		t.Fatal("unexpected written bytes count")
+	}
+	if rb.String() != "0123456789" {
+		t.Fatal("invalid buffer contents")
+	}
+	if rb.Cap() != 16 {
+		t.Fatal("unexpected capacity")
+	}
+
+	// Source ends early.
+	n, err = rb.WriteReader(strings.NewReader("abc"), 5)
+	if err != io.EOF || n != 3 {
+		t.Fatal("expected EOF")
+	}
+	if rb.String() != "0123456789abc" {
+		t.Fatal("invalid buffer contents")
+	}
+}
+
+func TestHooks(t *testing.T) {
+	rb := ringbuffer.New(16)
+
+	var reads, writes []int
+	rb.SetHooks(func(n int) {
+		reads = append(reads, n)
+		_ = rb.Len() // Calling back into the buffer must not deadlock.
+	}, func(n int) {
+		writes = append(writes, n)
+	})
+
+	_, _ = rb.Write(make([]byte, 10))
+	_, _ = rb.Write(make([]byte, 30)) // Grows the buffer.
+	_, _ = rb.Read(make([]byte, 25))
+	_, _ = rb.Read(make([]byte, 25))
+	_, _ = rb.Read(make([]byte, 25)) // Nothing to read.
+
+	if fmt.Sprint(writes) != "[10 30]" {
+		t.Fatal("unexpected write hook counts")
+	}
+	if fmt.Sprint(reads) != "[25 15]" {
+		t.Fatal("unexpected read hook counts")
+	}
+
+	// Other methods that transfer data are also reported.
+	reads, writes = nil, nil
+	_, _ = rb.WriteString("0123")
+	_ = rb.WriteByte('4')
+	_, _ = rb.ReadFrom(strings.NewReader("56789"))
+	_, _ = rb.ReadByte()
+	_, _ = rb.ReadN(2)
+	_, _ = rb.Discard(3)
+	_, _ = rb.WriteTo(io.Discard)
+	if fmt.Sprint(writes) != "[4 1 5]" {
+		t.Fatal("unexpected write hook counts")
+	}
+	if fmt.Sprint(reads) != "[1 2 3 4]" {
+		t.Fatal("unexpected read hook counts")
+	}
+
+	// Data read through consumers is reported once released.
+	reads = nil
+	c1 := rb.NewConsumer()
+	c2 := rb.NewConsumer()
+	_, _ = rb.WriteString("abcd")
+	_, _ = c1.Read(make([]byte, 4))
+	_, _ = c2.Read(make([]byte, 2))
+	if fmt.Sprint(reads) != "[2]" {
+		t.Fatal("unexpected read hook counts")
+	}
+}
+
+func TestNewFromBytes(t *testing.T) {
+	data := []byte("0123456789abcdefXYZ")
+	rb := ringbuffer.NewFromBytes(data, 16)
+	if rb.Len() != len(data) {
+		t.Fatal("unexpected buffer length")
+	}
+	if rb.Cap() != 32 {
+		t.Fatal("unexpected capacity")
+	}
+
+	buf := make([]byte, 32)
+	n, err := rb.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf[:n], data) {
+		t.Fatal("invalid data read")
+	}
+}
+
+func TestTee(t *testing.T) {
+	rb := newWrappedRingBuffer("0123456789")
+
+	var tee bytes.Buffer
+	rb.SetTee(&tee)
+
+	buf := make([]byte, 3)
+	for {
+		_, err := rb.Read(buf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if tee.String() != "0123456789" {
+		t.Fatal("invalid tee contents")
+	}
+
+	// Tee errors are reported by Read.
+	_, _ = rb.WriteString("abc")
+	_, pw := io.Pipe()
+	_ = pw.Close()
+	rb.SetTee(pw)
+	n, err := rb.Read(buf)
+	if n != 3 || err != io.ErrClosedPipe {
+		t.Fatal("expected tee error")
+	}
+}
+
+func TestReadAtMost(t *testing.T) {
+	rb := newWrappedRingBuffer("0123456789")
+	buf := make([]byte, 64)
+
+	n, err := rb.ReadAtMost(buf, 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf[:n]) != "012345" {
+		t.Fatal("invalid data read")
+	}
+
+	n, err = rb.ReadAtMost(buf, 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf[:n]) != "6789" {
+		t.Fatal("invalid data read")
+	}
+	if rb.Len() != 0 {
+		t.Fatal("unexpected buffer length")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	rb := newWrappedRingBuffer("0123456789")
+	if rb.Validate() != nil {
+		t.Fatal("unexpected validation error")
+	}
+
+	// A smaller initial capacity is valid until the buffer grows.
+	rb = ringbuffer.NewWithCapacity(8, 16)
+	if rb.Validate() != nil {
+		t.Fatal("unexpected validation error")
+	}
+	_, _ = rb.Write(make([]byte, 20))
+	rb.SetGrowSize(64)
+	if rb.Validate() != ringbuffer.ErrInvalidCapacity {
+		t.Fatal("expected invalid capacity")
+	}
+
+	// A maximum size below the current capacity.
+	rb = ringbuffer.New(1 << 20)
+	rb.SetMaxSize(1000)
+	if rb.Validate() != nil {
+		t.Fatal("unexpected validation error")
+	}
+
+	// Growth limited by the maximum size.
+	rb = ringbuffer.NewWithCapacity(8, 64)
+	rb.SetMaxSize(40)
+	_, _ = rb.Write(make([]byte, 30))
+	if rb.Cap() != 40 || rb.Validate() != nil {
+		t.Fatal("unexpected validation error")
+	}
+
+	// A linear buffer shrunk back to its initial capacity.
+	rb = ringbuffer.NewWithGrowStep(10, 100)
+	_, _ = rb.Write(make([]byte, 30))
+	_, _ = rb.Read(make([]byte, 25))
+	rb.Shrink()
+	if rb.Cap() != 10 || rb.Validate() != nil {
+		t.Fatal("unexpected validation error")
+	}
+
+	rb = newWrappedRingBuffer("0123456789")
+	rb.SetState(rb.Cap(), 0)
+	if rb.Validate() != ringbuffer.ErrInvalidReadPos {
+		t.Fatal("expected invalid read-position")
+	}
+
+	rb = newWrappedRingBuffer("0123456789")
+	rb.SetState(0, rb.Cap()+1)
+	if rb.Validate() != ringbuffer.ErrInvalidWritten {
+		t.Fatal("expected invalid unread length")
+	}
+
+	rb = newWrappedRingBuffer("0123456789")
+	c1 := rb.NewConsumer()
+	c2 := rb.NewConsumer()
+	_, _ = c1.Read(make([]byte, 5))
+	rb.SetState(0, 2)
+	if rb.Validate() != ringbuffer.ErrInvalidConsumer {
+		t.Fatal("expected invalid consumer read-position")
+	}
+	_ = c1.Close()
+	_ = c2.Close()
+}
+
+func TestChunks(t *testing.T) {
+	rb := newWrappedRingBuffer("0123456789")
+
+	var chunks []string
+	rb.Chunks(3, func(chunk []byte) bool {
+		chunks = append(chunks, string(chunk))
+		return true
+	})
+	if strings.Join(chunks, ",") != "012,345,678,9" {
+		t.Fatal("invalid chunks")
+	}
+	if rb.Len() != 10 {
+		t.Fatal("unexpected buffer length")
+	}
+
+	chunks = nil
+	rb.Chunks(4, func(chunk []byte) bool {
+		chunks = append(chunks, string(chunk))
+		return len(chunks) < 2
+	})
+	if strings.Join(chunks, ",") != "0123,4567" {
+		t.Fatal("invalid chunks")
+	}
+}
+
+func TestDrain(t *testing.T) {
+	rb := newWrappedRingBuffer("0123456789")
+
+	// The writer accepts less than requested.
+	w := &limitedWriter{
+		limit: 5,
+	}
+	n, err := rb.Drain(w, 8)
+	if err != io.ErrShortWrite {
+		t.Fatal("expected short write")
+	}
+	if n != 5 || w.buf.String() != "01234" {
+		t.Fatal("invalid data written")
+	}
+	if rb.String() != "56789" {
+		t.Fatal("invalid buffer contents")
+	}
+
+	// More than buffered.
+	w.limit = 100
+	n, err = rb.Drain(w, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 5 || w.buf.String() != "0123456789" {
+		t.Fatal("invalid data written")
+	}
+	if rb.Len() != 0 {
+		t.Fatal("unexpected buffer length")
+	}
+}
+
+func TestNewExact(t *testing.T) {
+	rb := ringbuffer.NewExact(100)
+	if rb.Cap() != 100 {
+		t.Fatal("unexpected initial capacity")
+	}
+
+	_, _ = rb.Write(make([]byte, 101))
+	if rb.Cap() != 200 {
+		t.Fatal("unexpected capacity after grow")
+	}
+	_, _ = rb.Write(make([]byte, 150))
+	if rb.Cap() != 300 {
+		t.Fatal("unexpected capacity after second grow")
+	}
+
+	// Shrinking keeps the linear capacities.
+	_, _ = rb.Write(make([]byte, 700))
+	_, _ = rb.Read(make([]byte, 801))
+	rb.Shrink()
+	if rb.Cap() != 200 || rb.Len() != 150 {
+		t.Fatal("unexpected capacity after shrink")
+	}
+
+	// Sizes above the maximum grow size are not limited.
+	rb = ringbuffer.NewExact(3 << 20)
+	if rb.Cap() != 3<<20 || len(rb.BackingArray()) != 3<<20 {
+		t.Fatal("unexpected initial capacity")
+	}
+}
+
+func TestScanWithLen(t *testing.T) {
+	rb := newWrappedRingBuffer("0123456789")
+
+	count := 0
+	rb.ScanWithLen(func(elem byte, idx int, total int) bool {
+		if total != 10 {
+			t.Fatal("unexpected total length")
+		}
+		if elem != byte('0'+idx) {
+			t.Fatal("invalid element scanned")
+		}
+		count += 1
+		return false
+	})
+	if count != 10 {
+		t.Fatal("unexpected scanned elements count")
+	}
+}
+
+func TestAllocBytes(t *testing.T) {
+	rb := ringbuffer.New(16)
+
+	_, _ = rb.Write(make([]byte, 10))
+	if rb.AllocBytes() != 0 {
+		t.Fatal("unexpected allocated bytes")
+	}
+	_, _ = rb.Write(make([]byte, 10)) // Grows to 32.
+	_, _ = rb.Write(make([]byte, 30)) // Grows to 64.
+	if rb.AllocBytes() != 32+64 {
+		t.Fatal("unexpected allocated bytes")
+	}
+	_, _, grows := rb.Stats()
+	if grows != 2 {
+		t.Fatal("unexpected grows count")
+	}
+}
+
+func BenchmarkRoundTrip(b *testing.B) {
+	rb := ringbuffer.New(16)
+	buf := make([]byte, 1500)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = rb.Write(buf)
+		_, _ = rb.Read(buf)
+	}
+	b.ReportMetric(float64(rb.AllocBytes()), "alloc-bytes")
+}
+
+func TestWriteDeadline(t *testing.T) {
+	rb := ringbuffer.NewBounded(16)
+	_, _ = rb.Write(make([]byte, 12))
+
+	// Space is freed before the deadline.
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		_, _ = rb.Discard(12)
+	}()
+	n, err := rb.WriteDeadline([]byte("0123456789"), time.Now().Add(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 10 || rb.String() != "0123456789" {
+		t.Fatal("unexpected buffer contents")
+	}
+
+	// Space is never freed.
+	start := time.Now()
+	n, err = rb.WriteDeadline([]byte("abcdefghij"), time.Now().Add(50*time.Millisecond))
+	if err != os.ErrDeadlineExceeded {
+		t.Fatal("expected deadline exceeded")
+	}
+	if n != 6 || rb.String() != "0123456789abcdef" {
+		t.Fatal("unexpected buffer contents")
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("write did not return in time")
+	}
+}
+
+func TestRewind(t *testing.T) {
+	rb := newWrappedRingBuffer("0123456789")
+	buf := make([]byte, 16)
+
+	// Read across the wrap boundary and rewind.
+	_, _ = rb.Read(buf[:8])
+	err := rb.Rewind(6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, _ := rb.Read(buf)
+	if string(buf[:n]) != "23456789" {
+		t.Fatal("invalid data read")
+	}
+
+	// Part of the read data is overwritten.
+	_, _ = rb.Write([]byte("abcdefghijkl"))
+	if rb.Rewind(5) == nil {
+		t.Fatal("expected rewind error")
+	}
+	err = rb.Rewind(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rb.String() != "6789abcdefghijkl" {
+		t.Fatal("invalid buffer contents")
+	}
+
+	// Rewinding wakes up blocked readers.
+	_, _ = rb.Read(buf)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = rb.Rewind(4)
+	}()
+	n, err = rb.ReadFull(buf[:4])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf[:n]) != "ijkl" {
+		t.Fatal("invalid data read")
+	}
+}
+
+func TestFlushWatermark(t *testing.T) {
+	rb := ringbuffer.New(16)
+
+	flushes := 0
+	rb.SetFlushWatermark(10, func() {
+		flushes += 1
+	})
+
+	for i := 0; i < 3; i++ {
+		_, _ = rb.Write([]byte("abc"))
+	}
+	if flushes != 0 {
+		t.Fatal("flushed too early")
+	}
+	_, _ = rb.Write([]byte("abc"))
+	if flushes != 1 {
+		t.Fatal("not flushed")
+	}
+	_, _ = rb.Write([]byte("abc"))
+	if flushes != 1 {
+		t.Fatal("flushed twice")
+	}
+
+	// Drain and cross the watermark again.
+	_, _ = rb.Read(make([]byte, 15))
+	_, _ = rb.Write(make([]byte, 12))
+	if flushes != 2 {
+		t.Fatal("not flushed again")
+	}
+
+	// Other methods that add data also cross the watermark.
+	_, _ = rb.Read(make([]byte, 12))
+	_, _ = rb.WriteString("0123456789")
+	if flushes != 3 {
+		t.Fatal("not flushed by WriteString")
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	rb := newWrappedRingBuffer("0123456789")
+
+	if rb.Checksum() != crc32.ChecksumIEEE(rb.Bytes()) {
+		t.Fatal("checksum mismatch")
+	}
+	if rb.Len() != 10 {
+		t.Fatal("unexpected buffer length")
+	}
+}
+
+func TestWriteGrew(t *testing.T) {
+	rb := ringbuffer.New(16)
+
+	n, grew, err := rb.WriteGrew(make([]byte, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 10 || grew {
+		t.Fatal("unexpected grow")
+	}
+	n, grew, err = rb.WriteGrew(make([]byte, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 10 || !grew {
+		t.Fatal("expected grow")
+	}
+
+	// Hooks are notified like in Write.
+	writes := 0
+	flushes := 0
+	rb.SetHooks(nil, func(n int) {
+		writes += n
+	})
+	rb.SetFlushWatermark(24, func() {
+		flushes += 1
+		_ = rb.Len() // Called outside the lock.
+	})
+	_, _, _ = rb.WriteGrew(make([]byte, 4))
+	if writes != 4 || flushes != 1 {
+		t.Fatal("hooks not notified")
+	}
+}
+
+func TestReadMulti(t *testing.T) {
+	rb := newWrappedRingBuffer("0123456789")
+
+	part1 := make([]byte, 3)
+	part2 := make([]byte, 5)
+	n, err := rb.ReadMulti(part1, nil, part2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 8 || string(part1) != "012" || string(part2) != "34567" {
+		t.Fatal("invalid data read")
+	}
+
+	// The buffer drains before filling all the parts.
+	n, err = rb.ReadMulti(part1, part2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 || string(part1[:2]) != "89" {
+		t.Fatal("invalid data read")
+	}
+
+	_, err = rb.ReadMulti(part1)
+	if err != io.EOF {
+		t.Fatal("expected EOF")
+	}
+}
+
+func TestSwap(t *testing.T) {
+	rb := newWrappedRingBuffer("0123456789")
+
+	old, err := rb.Swap([]byte("abcdefghijklmnopqrst"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(old) != "0123456789" {
+		t.Fatal("invalid swapped data")
+	}
+
+	buf := make([]byte, 32)
+	n, _ := rb.Read(buf)
+	if string(buf[:n]) != "abcdefghijklmnopqrst" {
+		t.Fatal("invalid data read")
+	}
+
+	// New data that does not fit leaves the buffer untouched.
+	rb = ringbuffer.NewBounded(16)
+	_, _ = rb.WriteString("0123456789")
+	_, err = rb.Swap(make([]byte, 40))
+	if err != ringbuffer.ErrBufferOverflow {
+		t.Fatal("expected buffer overflow")
+	}
+	rb2 := ringbuffer.New(16)
+	rb2.SetMaxSize(32)
+	_, err = rb2.Swap(make([]byte, 40))
+	if err != ringbuffer.ErrBufferOverflow {
+		t.Fatal("expected buffer overflow")
+	}
+	_ = rb.Close()
+	_, err = rb.Swap([]byte("abc"))
+	if err != ringbuffer.ErrClosed {
+		t.Fatal("expected closed error")
+	}
+	if rb.String() != "0123456789" {
+		t.Fatal("invalid buffer contents")
+	}
+}
+
+func TestEmptyPeek(t *testing.T) {
+	rb := ringbuffer.New(16)
+	if !rb.AtEOF() {
+		t.Fatal("expected EOF")
+	}
+
+	n, err := rb.Peek(nil)
+	if n != 0 || err != io.EOF {
+		t.Fatal("expected EOF")
+	}
+	n, err = rb.Peek(make([]byte, 4))
+	if n != 0 || err != io.EOF {
+		t.Fatal("expected EOF")
+	}
+	n, err = rb.Read(nil)
+	if n != 0 || err != io.EOF {
+		t.Fatal("expected EOF")
+	}
+	n, err = rb.ReadMulti(nil, []byte{})
+	if n != 0 || err != io.EOF {
+		t.Fatal("expected EOF")
+	}
+	c := rb.NewConsumer()
+	n, err = c.Read(nil)
+	if n != 0 || err != io.EOF {
+		t.Fatal("expected EOF")
+	}
+	_ = c.Close()
+
+	_, _ = rb.Write([]byte("abc"))
+	if rb.AtEOF() {
+		t.Fatal("unexpected EOF")
+	}
+	n, err = rb.Peek(nil)
+	if n != 0 || err != nil {
+		t.Fatal("unexpected peek result")
+	}
+}
+
+func TestSection(t *testing.T) {
+	rb := newWrappedRingBuffer("0123456789")
+
+	data, err := io.ReadAll(rb.Section(2, 5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "23456" {
+		t.Fatal("invalid section data")
+	}
+	if rb.Len() != 10 {
+		t.Fatal("unexpected buffer length")
+	}
+
+	_, err = rb.Section(8, 3).Read(make([]byte, 4))
+	if err == nil || err == io.EOF {
+		t.Fatal("expected out of range error")
+	}
+}
+
+func TestGrowStrategy(t *testing.T) {
+	// Doubling.
+	rb := ringbuffer.New(16)
+	rb.SetGrowStrategy(func(current int, needed int) int {
+		for current < needed {
+			current *= 2
+		}
+		return current
+	})
+	_, _ = rb.Write(make([]byte, 17))
+	if rb.Cap() != 32 {
+		t.Fatal("unexpected capacity")
+	}
+	_, _ = rb.Write(make([]byte, 50))
+	if rb.Cap() != 128 {
+		t.Fatal("unexpected capacity")
+	}
+
+	// Fixed increment.
+	rb = ringbuffer.New(16)
+	rb.SetGrowStrategy(func(current int, needed int) int {
+		return current + 10
+	})
+	_, _ = rb.Write(make([]byte, 20))
+	if rb.Cap() != 26 {
+		t.Fatal("unexpected capacity")
+	}
+
+	// Too small values are raised to the needed capacity.
+	_, _ = rb.Write(make([]byte, 30))
+	if rb.Cap() != 50 {
+		t.Fatal("unexpected capacity")
+	}
+}
+
+func TestPeekToken(t *testing.T) {
+	rb := newWrappedRingBuffer("0123456789")
+
+	data, token, err := rb.PeekToken(6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "012345" {
+		t.Fatal("invalid data peeked")
+	}
+	err = rb.CommitToken(token, 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rb.String() != "6789" {
+		t.Fatal("invalid buffer contents")
+	}
+
+	// An intervening write invalidates the token.
+	_, token, _ = rb.PeekToken(2)
+	_, _ = rb.Write([]byte("ab"))
+	err = rb.CommitToken(token, 2)
+	if err != ringbuffer.ErrConflict {
+		t.Fatal("expected conflict")
+	}
+	if rb.String() != "6789ab" {
+		t.Fatal("invalid buffer contents")
+	}
+}
+
+func TestHistory(t *testing.T) {
+	rb := newWrappedRingBuffer("0123456789")
+
+	_, _ = rb.Read(make([]byte, 8))
+	if string(rb.History(6)) != "234567" {
+		t.Fatal("invalid history")
+	}
+	history := rb.History(100)
+	if len(history) != 14 || !bytes.HasSuffix(history, []byte("01234567")) {
+		t.Fatal("invalid history")
+	}
+
+	// Overwrite part of the history.
+	_, _ = rb.Write([]byte("abcdefghijkl"))
+	if string(rb.History(100)) != "67" {
+		t.Fatal("invalid history")
+	}
+	if rb.String() != "89abcdefghijkl" {
+		t.Fatal("invalid buffer contents")
+	}
+}
+
+func TestLineNotifier(t *testing.T) {
+	rb := ringbuffer.New(16)
+	w, ch := rb.LineNotifier()
+
+	signals := 0
+	countSignals := func() {
+		for {
+			select {
+			case <-ch:
+				signals += 1
+			default:
+				return
+			}
+		}
+	}
+
+	_, _ = w.Write([]byte("Hel"))
+	countSignals()
+	if signals != 0 {
+		t.Fatal("unexpected signal")
+	}
+	_, _ = w.Write([]byte("lo\nWor"))
+	countSignals()
+	if signals != 1 {
+		t.Fatal("expected signal")
+	}
+	_, _ = w.Write([]byte("ld\n"))
+	_, _ = w.Write([]byte("!\n")) // Coalesced with the previous signal.
+	countSignals()
+	if signals != 2 {
+		t.Fatal("unexpected signals count")
+	}
+
+	for _, expected := range []string{"Hello\n", "World\n", "!\n"} {
+		line, err := rb.ReadLine()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(line) != expected {
+			t.Fatal("invalid line read")
+		}
+	}
+}
+
+func TestEndianIntegers(t *testing.T) {
+	// Each value straddles the end of the backing array.
+	rb := newWrappedRingBuffer("012")
+	_ = rb.WriteUint16BE(0x0102)
+	_ = rb.WriteUint16LE(0x0102)
+	if !bytes.Equal(rb.Bytes()[3:], []byte{1, 2, 2, 1}) {
+		t.Fatal("invalid 16-bit encoding")
+	}
+	_, _ = rb.Read(make([]byte, 3))
+	v16, err := rb.ReadUint16BE()
+	if err != nil || v16 != 0x0102 {
+		t.Fatal("invalid 16-bit big-endian value")
+	}
+	v16, err = rb.ReadUint16LE()
+	if err != nil || v16 != 0x0102 {
+		t.Fatal("invalid 16-bit little-endian value")
+	}
+
+	rb = newWrappedRingBuffer("01")
+	_ = rb.WriteUint32BE(0x01020304)
+	_ = rb.WriteUint32LE(0x01020304)
+	if !bytes.Equal(rb.Bytes()[2:], []byte{1, 2, 3, 4, 4, 3, 2, 1}) {
+		t.Fatal("invalid 32-bit encoding")
+	}
+	_, _ = rb.Read(make([]byte, 2))
+	v32, err := rb.ReadUint32BE()
+	if err != nil || v32 != 0x01020304 {
+		t.Fatal("invalid 32-bit big-endian value")
+	}
+	v32, err = rb.ReadUint32LE()
+	if err != nil || v32 != 0x01020304 {
+		t.Fatal("invalid 32-bit little-endian value")
+	}
+
+	rb = newWrappedRingBuffer("0")
+	_ = rb.WriteUint64BE(0x0102030405060708)
+	_ = rb.WriteUint64LE(0x0102030405060708)
+	if !bytes.Equal(rb.Bytes()[1:], []byte{1, 2, 3, 4, 5, 6, 7, 8, 8, 7, 6, 5, 4, 3, 2, 1}) {
+		t.Fatal("invalid 64-bit encoding")
+	}
+	_, _ = rb.Read(make([]byte, 1))
+	v64, err := rb.ReadUint64BE()
+	if err != nil || v64 != 0x0102030405060708 {
+		t.Fatal("invalid 64-bit big-endian value")
+	}
+	v64, err = rb.ReadUint64LE()
+	if err != nil || v64 != 0x0102030405060708 {
+		t.Fatal("invalid 64-bit little-endian value")
+	}
+
+	// Not enough data.
+	_, _ = rb.WriteString("abc")
+	_, err = rb.ReadUint32BE()
+	if err != ringbuffer.ErrShortRead {
+		t.Fatal("expected short read")
+	}
+	if rb.Len() != 3 {
+		t.Fatal("unexpected buffer length")
+	}
+}
+
+func TestReserve(t *testing.T) {
+	rb := newWrappedRingBuffer("ab")
+
+	offset, err := rb.Reserve(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offset != 2 {
+		t.Fatal("unexpected reserved offset")
+	}
+	body := []byte("Hello World")
+	_, _ = rb.Write(body)
+
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(body)))
+	_, err = rb.OverwriteAt(offset, length[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _ = rb.Discard(2)
+	size, err := rb.ReadUint32BE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame, err := rb.ReadN(int(size))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(frame, body) {
+		t.Fatal("invalid frame read")
+	}
+}
+
+func TestScanSnapshot(t *testing.T) {
+	rb := newWrappedRingBuffer("0123456789")
+
+	var visited []byte
+	rb.ScanSnapshot(func(elem byte, idx int) bool {
+		// Modifying the buffer does not affect the iteration.
+		_, _ = rb.Write([]byte("x"))
+		_, _ = rb.ReadByte()
+		visited = append(visited, elem)
+		return false
+	})
+	if string(visited) != "0123456789" {
+		t.Fatal("invalid scanned elements")
+	}
+	if rb.String() != "xxxxxxxxxx" {
+		t.Fatal("invalid buffer contents")
+	}
+}
+
+func TestWriteByteN(t *testing.T) {
+	rb := ringbuffer.NewBounded(16)
+	_, _ = rb.Write(make([]byte, 14))
+	_, _ = rb.Read(make([]byte, 14))
+	_, _ = rb.WriteString("ab")
+
+	// The padding straddles the end of the backing array.
+	err := rb.WriteByteN('.', 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = rb.WriteString("cd")
+	if rb.String() != "ab...cd" {
+		t.Fatal("invalid buffer contents")
+	}
+
+	// Nothing is written if it does not fit.
+	err = rb.WriteByteN('.', 10)
+	if err != ringbuffer.ErrBufferOverflow {
+		t.Fatal("expected buffer overflow")
+	}
+	if rb.Len() != 7 {
+		t.Fatal("unexpected buffer length")
+	}
+}
+
+func TestPartition(t *testing.T) {
+	rb := newWrappedRingBuffer("0123456789")
+
+	parts := rb.Partition(3)
+	if len(parts) != 3 || len(parts[0]) != 4 || len(parts[1]) != 3 || len(parts[2]) != 3 {
+		t.Fatal("unexpected partition sizes")
+	}
+	if !bytes.Equal(bytes.Join(parts, nil), rb.Bytes()) {
+		t.Fatal("invalid partitions")
+	}
+
+	// More partitions than bytes.
+	parts = rb.Partition(12)
+	if len(parts) != 12 || len(parts[9]) != 1 || len(parts[10]) != 0 || len(parts[11]) != 0 {
+		t.Fatal("unexpected partition sizes")
+	}
+	if !bytes.Equal(bytes.Join(parts, nil), rb.Bytes()) {
+		t.Fatal("invalid partitions")
+	}
+}
+
+func TestZeroOnRead(t *testing.T) {
+	rb := ringbuffer.New(16)
+	_, _ = rb.Write(make([]byte, 12))
+	_, _ = rb.Read(make([]byte, 12))
+	_, _ = rb.Write(bytes.Repeat([]byte{0xFF}, 16))
+	rb.SetZeroOnRead(true)
+
+	// Consume data across the wrap boundary.
+	_, _ = rb.Read(make([]byte, 6))
+	_, _ = rb.Discard(2)
+	if len(rb.ReadAll()) != 8 {
+		t.Fatal("unexpected data length")
+	}
+	_, _ = rb.WriteString("abcd")
+
+	if !bytes.Equal(rb.BackingArray(), append(make([]byte, 12), "abcd"...)) {
+		t.Fatal("consumed data not zeroed")
+	}
+	if rb.Rewind(1) == nil {
+		t.Fatal("expected rewind error")
+	}
+}
+
+func TestZeroOnCompact(t *testing.T) {
+	rb := ringbuffer.New(16)
+	_, _ = rb.WriteString("0123456789abcdef")
+	rb.SetZeroOnRead(true)
+
+	_, _ = rb.Discard(10)
+	rb.Compact()
+	if !bytes.Equal(rb.BackingArray(), append([]byte("abcdef"), make([]byte, 10)...)) {
+		t.Fatal("vacated storage not zeroed on compact")
+	}
+	if rb.String() != "abcdef" {
+		t.Fatal("invalid buffer contents")
+	}
+}
+
+func TestZeroOnDiscard(t *testing.T) {
+	rb := newWrappedRingBuffer("0123456789")
+	rb.SetZeroOnRead(true)
+
+	// The discarded tail straddles the end of the backing array.
+	rb.Truncate(2)
+	if rb.String() != "01" {
+		t.Fatal("invalid buffer contents")
+	}
+	expected := make([]byte, 16)
+	copy(expected[12:], "01")
+	if !bytes.Equal(rb.BackingArray(), expected) {
+		t.Fatal("storage not zeroed on truncate")
+	}
+
+	// Decoding releases the old storage.
+	data, _ := ringbuffer.NewFromBytes([]byte("abc"), 16).MarshalBinary()
+	old := rb.BackingArray()
+	err := rb.UnmarshalBinary(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(old, make([]byte, len(old))) {
+		t.Fatal("old storage not zeroed on decode")
+	}
+	if rb.String() != "abc" {
+		t.Fatal("invalid buffer contents")
+	}
+}
+
+func TestZeroOnReset(t *testing.T) {
+	rb := newWrappedRingBuffer("0123456789")
+	rb.SetZeroOnRead(true)
+
+	rb.Reset()
+	if !bytes.Equal(rb.BackingArray(), make([]byte, 16)) {
+		t.Fatal("storage not zeroed on reset")
+	}
+
+	// Shrinking releases the old storage.
+	_, _ = rb.Write(bytes.Repeat([]byte{0xFF}, 100))
+	_, _ = rb.Discard(96)
+	old := rb.BackingArray()
+	rb.Shrink()
+	if rb.Cap() != 16 || rb.String() != "\xff\xff\xff\xff" {
+		t.Fatal("unexpected buffer state")
+	}
+	if !bytes.Equal(old, make([]byte, len(old))) {
+		t.Fatal("old storage not zeroed on shrink")
+	}
+}
+
+func TestRecords(t *testing.T) {
+	rb := newWrappedRingBuffer("")
+
+	records := []string{"first", "", "third record"}
+	for idx, record := range records {
+		seq, err := rb.WriteRecord([]byte(record))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seq != uint64(idx+1) {
+			t.Fatal("unexpected sequence number")
+		}
+	}
+
+	for idx, record := range records {
+		seq, data, err := rb.ReadRecord()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seq != uint64(idx+1) || string(data) != record {
+			t.Fatal("invalid record read")
+		}
+	}
+
+	// Incomplete record.
+	_, _ = rb.WriteString("\x00\x00\x00\x00\x00\x00\x00\x04\x00\x00\x00\x05abc")
+	_, _, err := rb.ReadRecord()
+	if err != ringbuffer.ErrShortRead {
+		t.Fatal("expected short read")
+	}
+	if rb.Len() != 15 {
+		t.Fatal("unexpected buffer length")
+	}
+	_, _ = rb.WriteString("de")
+	seq, data, err := rb.ReadRecord()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seq != 4 || string(data) != "abcde" {
+		t.Fatal("invalid record read")
+	}
+	_, _, err = rb.ReadRecord()
+	if err != io.EOF {
+		t.Fatal("expected EOF")
+	}
+
+	// Closed buffer.
+	_, _ = rb.WriteString("\x00\x00\x00\x00\x00\x00\x00\x05\x00\x00\x00\x05abc")
+	_ = rb.Close()
+	_, _, err = rb.ReadRecord()
+	if err != io.ErrUnexpectedEOF {
+		t.Fatal("expected unexpected EOF")
+	}
+	_, _ = rb.Discard(15)
+	_, _, err = rb.ReadRecord()
+	if err != ringbuffer.ErrClosed {
+		t.Fatal("expected closed error")
+	}
+
+	// Record larger than a bounded buffer.
+	rb = ringbuffer.NewBounded(16)
+	_, _ = rb.WriteString("\x00\x00\x00\x00\x00\x00\x00\x01\x00\x00\x00\x05abc")
+	_, _, err = rb.ReadRecord()
+	if err == nil || err == ringbuffer.ErrShortRead {
+		t.Fatal("expected record too large error")
+	}
+}
+
+// newWrappedRingBuffer creates a buffer whose unread data wraps around the end of the
+// backing array after the fourth byte.
+func newWrappedRingBuffer(data string) *ringbuffer.RingBuffer {
+	rb := ringbuffer.New(16)
+	_, _ = rb.Write(make([]byte, 12))
+	_, _ = rb.Read(make([]byte, 12))
+	_, _ = rb.Write([]byte(data))
+	return rb
+}
@@ -0,0 +1,127 @@
+package ringbuffer
+
+import (
+	"io"
+	"sync/atomic"
+)
+
+// -----------------------------------------------------------------------------
+
+// SPSCRingBuffer represents a fixed-capacity circular buffer that can be safely used, without
+// locking, by a single producer goroutine and a single consumer goroutine at the same time.
+// Calling Write from more than one goroutine, or Read from more than one goroutine, at the
+// same time is not supported.
+type SPSCRingBuffer struct {
+	buf      []byte
+	readPos  int          // Holds the read-position in the buffer. Owned by the consumer.
+	writePos int          // Holds the write-position in the buffer. Owned by the producer.
+	written  atomic.Int64 // Holds the number of bytes written to the buffer.
+}
+
+// -----------------------------------------------------------------------------
+
+// NewSPSC returns a new single-producer/single-consumer circular buffer.
+// The capacity is rounded up to the next power of two like in New, but the buffer
+// never grows. Writes that do not fit in the free space are truncated.
+func NewSPSC(size int) *SPSCRingBuffer {
+	if size < minGrowSize {
+		size = minGrowSize
+	} else if size > maxGrowSize {
+		size = maxGrowSize
+	} else {
+		size = nextPowerOfTwo(size)
+	}
+
+	// Create and initialize the ring buffer.
+	return &SPSCRingBuffer{
+		buf: make([]byte, size),
+	}
+}
+
+// Read reads up to len(p) bytes from the buffer and stores them in p.
+// It returns the number of bytes read and any error encountered.
+// At the end of the buffer, Read returns 0, io.EOF.
+// Read must only be called from the consumer goroutine.
+func (r *SPSCRingBuffer) Read(p []byte) (n int, err error) {
+	n = len(p)
+	if n == 0 {
+		return 0, nil
+	}
+
+	available := int(r.written.Load())
+	if available == 0 {
+		return 0, io.EOF // Nothing to read.
+	}
+	if n > available {
+		n = available
+	}
+
+	// Read from the buffer.
+	len1 := len(r.buf) - r.readPos
+	if n <= len1 {
+		copy(p, r.buf[r.readPos:r.readPos+n])
+	} else {
+		copy(p, r.buf[r.readPos:])
+		copy(p[len1:n], r.buf)
+	}
+
+	// Advance the read-position.
+	r.readPos += n
+	if r.readPos >= len(r.buf) {
+		r.readPos -= len(r.buf)
+	}
+	r.written.Add(-int64(n))
+
+	// Done
+	return
+}
+
+// Write writes len(p) bytes from p to the buffer.
+// It returns the number of bytes written and io.ErrShortWrite if not all the data fits in
+// the free space.
+// Write must only be called from the producer goroutine.
+func (r *SPSCRingBuffer) Write(p []byte) (n int, err error) {
+	n = len(p)
+	if n == 0 {
+		return 0, nil
+	}
+
+	free := len(r.buf) - int(r.written.Load())
+	if n > free {
+		// Write only what fits in the free space.
+		n = free
+		err = io.ErrShortWrite
+		if n == 0 {
+			return
+		}
+	}
+
+	// Write to the buffer.
+	len1 := len(r.buf) - r.writePos
+	if n <= len1 {
+		copy(r.buf[r.writePos:r.writePos+n], p)
+	} else {
+		copy(r.buf[r.writePos:], p[:len1])
+		copy(r.buf, p[len1:n])
+	}
+
+	// Advance the write-position.
+	r.writePos += n
+	if r.writePos >= len(r.buf) {
+		r.writePos -= len(r.buf)
+	}
+	r.written.Add(int64(n))
+
+	// Done
+	return
+}
+
+// Len returns the number of bytes of the unread portion of the buffer.
+func (r *SPSCRingBuffer) Len() int {
+	return int(r.written.Load())
+}
+
+// Cap returns the capacity of the buffer.
+func (r *SPSCRingBuffer) Cap() int {
+	return len(r.buf)
+}
@@ -0,0 +1,70 @@
+package ringbuffer_test
+
+import (
+	"bytes"
+	"io"
+	"runtime"
+	"testing"
+
+	"github.com/mxmauro/ringbuffer"
+)
+
+// -----------------------------------------------------------------------------
+
+func TestSPSCRingBuffer(t *testing.T) {
+	rb := ringbuffer.NewSPSC(64)
+
+	data := make([]byte, 1048576)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+
+	// Producer.
+	go func() {
+		remaining := data
+		for len(remaining) > 0 {
+			chunk := remaining
+			if len(chunk) > 37 {
+				chunk = chunk[:37]
+			}
+			n, _ := rb.Write(chunk)
+			if n == 0 {
+				runtime.Gosched()
+			}
+			remaining = remaining[n:]
+		}
+	}()
+
+	// Consumer.
+	received := make([]byte, 0, len(data))
+	buf := make([]byte, 29)
+	for len(received) < len(data) {
+		n, err := rb.Read(buf)
+		if err != nil && err != io.EOF {
+			t.Fatal(err)
+		}
+		if n == 0 {
+			runtime.Gosched()
+		}
+		received = append(received, buf[:n]...)
+	}
+
+	if !bytes.Equal(received, data) {
+		t.Fatal("invalid data received")
+	}
+	if rb.Len() != 0 {
+		t.Fatal("unexpected buffer length")
+	}
+}
+
+func TestSPSCRingBufferFull(t *testing.T) {
+	rb := ringbuffer.NewSPSC(16)
+
+	n, err := rb.Write(make([]byte, 20))
+	if err != io.ErrShortWrite || n != 16 {
+		t.Fatal("expected short write")
+	}
+	if rb.Len() != rb.Cap() {
+		t.Fatal("unexpected buffer length")
+	}
+}